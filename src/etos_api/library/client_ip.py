@@ -0,0 +1,108 @@
+# Copyright 2021 Axis Communications AB.
+#
+# For a full list of individual contributors, please see the commit history.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+"""ETOS API client IP resolution behind trusted proxies."""
+import os
+from ipaddress import ip_address, ip_network
+
+
+def parse_networks(value):
+    """Parse a comma separated list of IP addresses and CIDRs.
+
+    :param value: Comma separated networks, e.g. '10.0.0.0/8,127.0.0.1'.
+    :type value: str
+    :return: Parsed networks.
+    :rtype: list
+    """
+    return [
+        ip_network(network.strip(), strict=False)
+        for network in value.split(",")
+        if network.strip()
+    ]
+
+
+TRUSTED_PROXIES = parse_networks(os.getenv("TRUSTED_PROXIES", ""))
+
+
+def is_valid(address):
+    """Check whether a forwarded address is a plain IP address.
+
+    Values such as 'unknown', obfuscated identifiers or addresses with ports
+    are not valid.
+
+    :param address: Address to check.
+    :type address: str
+    :return: Whether or not the address is a valid IP address.
+    :rtype: bool
+    """
+    try:
+        ip_address(address)
+    except ValueError:
+        return False
+    return True
+
+
+def is_trusted(address, trusted_proxies):
+    """Check whether an address belongs to one of the trusted proxy networks.
+
+    :param address: IP address to check.
+    :type address: str
+    :param trusted_proxies: Trusted proxy networks.
+    :type trusted_proxies: list
+    :return: Whether or not the address is a trusted proxy.
+    :rtype: bool
+    """
+    try:
+        address = ip_address(address)
+    except ValueError:
+        return False
+    return any(address in network for network in trusted_proxies)
+
+
+def resolve_client_ip(peer, headers, trusted_proxies=None):
+    """Resolve the IP address of the client that originated a request.
+
+    Forwarding headers are only honored if the request came from a trusted
+    proxy. 'X-Forwarded-For' is walked from the right, skipping trusted proxies,
+    so that a client cannot spoof its address by adding entries of its own.
+    Multiple 'X-Forwarded-For' headers are treated as one comma separated list.
+    'X-Real-IP' is used if there is no 'X-Forwarded-For' header. If the resolved
+    address is not a valid IP address the peer is used instead.
+
+    :param peer: IP address of the peer that connected to the ETOS API.
+    :type peer: str
+    :param headers: Request headers.
+    :type headers: :obj:`starlette.datastructures.Headers`
+    :param trusted_proxies: Trusted proxy networks. Defaults to TRUSTED_PROXIES.
+    :type trusted_proxies: list
+    :return: IP address of the client.
+    :rtype: str
+    """
+    if trusted_proxies is None:
+        trusted_proxies = TRUSTED_PROXIES
+    if peer is None or not is_trusted(peer, trusted_proxies):
+        return peer
+    forwarded_for = [
+        address.strip()
+        for address in ",".join(headers.getlist("X-Forwarded-For")).split(",")
+        if address.strip()
+    ]
+    if forwarded_for:
+        for address in reversed(forwarded_for):
+            if not is_trusted(address, trusted_proxies):
+                return address if is_valid(address) else peer
+        return forwarded_for[0]
+    real_ip = headers.get("X-Real-IP", "").strip()
+    return real_ip if is_valid(real_ip) else peer
@@ -30,9 +30,25 @@ class ContextLogging(logging.Logger):
     This context based logging module replaces the FORMAT_CONFIG
     with a ContextVar instead, which works with asyncio, and calls
     get for each logging method called.
+
+    The IP address of the client that sent the current request is added
+    to every log record as 'client_ip'.
     """
 
     identifier = ContextVar("identifier")
+    client_ip = ContextVar("client_ip")
+
+    def _extra(self, kwargs):
+        """Add the client IP of the current request to the log record.
+
+        :param kwargs: Keyword arguments to the logging call.
+        :type kwargs: dict
+        :return: Keyword arguments with the client IP as an extra field.
+        :rtype: dict
+        """
+        extra = dict(kwargs.get("extra") or {})
+        extra.setdefault("client_ip", self.client_ip.get(None))
+        return {**kwargs, "extra": extra}
 
     def critical(self, msg, *args, **kwargs):
         """Add identifier to critical calls.
@@ -40,7 +56,7 @@ class ContextLogging(logging.Logger):
         For documentation read :obj:`logging.Logger.critical`
         """
         FORMAT_CONFIG.identifier = self.identifier.get("Main")  # Default=Main
-        return super().critical(msg, *args, **kwargs)
+        return super().critical(msg, *args, **self._extra(kwargs))
 
     def error(self, msg, *args, **kwargs):
         """Add identifier to error calls.
@@ -48,7 +64,7 @@ class ContextLogging(logging.Logger):
         For documentation read :obj:`logging.Logger.error`
         """
         FORMAT_CONFIG.identifier = self.identifier.get("Main")  # Default=Main
-        return super().error(msg, *args, **kwargs)
+        return super().error(msg, *args, **self._extra(kwargs))
 
     def warning(self, msg, *args, **kwargs):
         """Add identifier to warning calls.
@@ -56,7 +72,7 @@ class ContextLogging(logging.Logger):
         For documentation read :obj:`logging.Logger.warning`
         """
         FORMAT_CONFIG.identifier = self.identifier.get("Main")  # Default=Main
-        return super().warning(msg, *args, **kwargs)
+        return super().warning(msg, *args, **self._extra(kwargs))
 
     def info(self, msg, *args, **kwargs):
         """Add identifier to info calls.
@@ -64,7 +80,7 @@ class ContextLogging(logging.Logger):
         For documentation read :obj:`logging.Logger.info`
         """
         FORMAT_CONFIG.identifier = self.identifier.get("Main")  # Default=Main
-        return super().info(msg, *args, **kwargs)
+        return super().info(msg, *args, **self._extra(kwargs))
 
     def debug(self, msg, *args, **kwargs):
         """Add identifier to debug calls.
@@ -72,7 +88,7 @@ class ContextLogging(logging.Logger):
         For documentation read :obj:`logging.Logger.debug`
         """
         FORMAT_CONFIG.identifier = self.identifier.get("Main")  # Default=Main
-        return super().debug(msg, *args, **kwargs)
+        return super().debug(msg, *args, **self._extra(kwargs))
 
 
 logging.setLoggerClass(ContextLogging)
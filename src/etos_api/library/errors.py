@@ -0,0 +1,169 @@
+# Copyright 2021 Axis Communications AB.
+#
+# For a full list of individual contributors, please see the commit history.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+"""ETOS API error responses."""
+import logging
+from http import HTTPStatus
+from typing import Any, Optional
+from fastapi import HTTPException
+from pydantic import BaseModel
+from starlette.responses import JSONResponse
+
+# There's a bug with pylint detecting subscription on Optional objects as problematic.
+# https://github.com/PyCQA/pylint/issues/3882
+# pylint: disable=unsubscriptable-object
+
+LOGGER = logging.getLogger(__name__)
+
+
+class ErrorResponse(BaseModel):
+    """Error body returned by all ETOS API endpoints.
+
+    'detail' is kept for clients that read the FastAPI default error body.
+    """
+
+    code: str
+    message: str
+    identifier: Optional[str]
+    retryable: bool = False
+    details: Optional[Any]
+    detail: Optional[Any]
+
+
+class EtosError(HTTPException):
+    """HTTP error that is returned to the client as an :obj:`ErrorResponse`."""
+
+    def __init__(  # pylint:disable=too-many-arguments
+        self,
+        status_code,
+        code,
+        message,
+        identifier=None,
+        retryable=False,
+        details=None,
+        retry_after=None,
+    ):
+        """Initialize the error.
+
+        :param status_code: HTTP status code of the response.
+        :type status_code: int
+        :param code: Machine readable error code.
+        :type code: str
+        :param message: Human readable error message.
+        :type message: str
+        :param identifier: ETOS identifier that the error concerns, if any.
+        :type identifier: str
+        :param retryable: Whether the client may retry the same request.
+        :type retryable: bool
+        :param details: Additional details about the error.
+        :type details: Any
+        :param retry_after: Seconds the client should wait before retrying.
+        :type retry_after: int
+        """
+        headers = None
+        if retry_after is not None:
+            headers = {"Retry-After": str(retry_after)}
+        super().__init__(status_code=status_code, detail=message, headers=headers)
+        self.code = code
+        self.identifier = identifier
+        self.retryable = retryable
+        self.details = details
+
+
+def _default_code(status_code):
+    """Get a default error code from an HTTP status code.
+
+    :param status_code: HTTP status code.
+    :type status_code: int
+    :return: Error code, e.g. 'not_found' for 404.
+    :rtype: str
+    """
+    try:
+        return HTTPStatus(status_code).phrase.lower().replace(" ", "_")
+    except ValueError:
+        return "http_error"
+
+
+def _response(body, status_code, headers=None):
+    """Create a JSON response from an error body.
+
+    :param body: Error body to return.
+    :type body: :obj:`ErrorResponse`
+    :param status_code: HTTP status code of the response.
+    :type status_code: int
+    :param headers: Additional headers of the response.
+    :type headers: dict
+    :return: JSON response with the error body.
+    :rtype: :obj:`starlette.responses.JSONResponse`
+    """
+    if body.detail is None:
+        body.detail = body.message
+    return JSONResponse(body.dict(), status_code=status_code, headers=headers)
+
+
+async def http_exception_handler(_, exception):
+    """Convert HTTP exceptions into :obj:`ErrorResponse` bodies.
+
+    :param exception: The exception that was raised.
+    :type exception: :obj:`starlette.exceptions.HTTPException`
+    :return: JSON response with the error body.
+    :rtype: :obj:`starlette.responses.JSONResponse`
+    """
+    if isinstance(exception, EtosError):
+        body = ErrorResponse(
+            code=exception.code,
+            message=exception.detail,
+            identifier=exception.identifier,
+            retryable=exception.retryable,
+            details=exception.details,
+        )
+    else:
+        body = ErrorResponse(
+            code=_default_code(exception.status_code),
+            message=str(exception.detail),
+            retryable=exception.status_code in (502, 503, 504),
+        )
+    return _response(body, exception.status_code, getattr(exception, "headers", None))
+
+
+async def validation_exception_handler(_, exception):
+    """Convert request validation errors into :obj:`ErrorResponse` bodies.
+
+    :param exception: The exception that was raised.
+    :type exception: :obj:`fastapi.exceptions.RequestValidationError`
+    :return: JSON response with the error body.
+    :rtype: :obj:`starlette.responses.JSONResponse`
+    """
+    errors = exception.errors()
+    body = ErrorResponse(
+        code="validation_error",
+        message="Request validation failed",
+        details=errors,
+        detail=errors,
+    )
+    return _response(body, 422)
+
+
+async def unhandled_exception_handler(_, exception):
+    """Convert unhandled exceptions into :obj:`ErrorResponse` bodies.
+
+    :param exception: The exception that was raised.
+    :type exception: :obj:`Exception`
+    :return: JSON response with the error body.
+    :rtype: :obj:`starlette.responses.JSONResponse`
+    """
+    LOGGER.exception("Unhandled exception: %r", exception)
+    body = ErrorResponse(code="internal_error", message="Internal Server Error")
+    return _response(body, 500)
@@ -15,39 +15,241 @@
 # limitations under the License.
 """Graphql query handler."""
 import asyncio
+import logging
+import os
+import ssl
+from collections import OrderedDict
+import aiohttp
 from gql import gql, AIOHTTPTransport, Client
+from gql.transport.exceptions import TransportServerError
+from etos_api.library.retry import retry, Backoff, EXTERNAL_DEPENDENCY
+from etos_api.library.timings import timed
+
+LOGGER = logging.getLogger(__name__)
+
+
+def _setting(value, name, default=None, convert=str):
+    """Get a setting from an argument, falling back to an environment variable.
+
+    :param value: Value passed as argument. Used if not None.
+    :type value: any
+    :param name: Name of the environment variable to fall back to.
+    :type name: str
+    :param default: Default value if neither argument nor variable is set.
+    :type default: any
+    :param convert: Function to convert the environment variable with.
+    :type convert: function
+    :return: The setting.
+    :rtype: any
+    """
+    if value is not None:
+        return value
+    env = os.getenv(name)
+    if env is None:
+        return default
+    return convert(env)
 
 
 class GraphqlQueryHandler:  # pylint:disable=too-few-public-methods
-    """Handle Graphql queries."""
+    """Handle Graphql queries.
+
+    All client options default to these environment variables:
 
-    def __init__(self, etos):
+    - ETOS_GRAPHQL_URL: URL to the event repository. Defaults to the ETOS library
+      GraphQL server.
+    - ETOS_GRAPHQL_TIMEOUT: Timeout for each query, in seconds. Defaults to the
+      ETOS library HTTP and wait timeouts.
+    - ETOS_GRAPHQL_RETRIES, ETOS_GRAPHQL_BACKOFF: Number of retries on server and
+      connection errors and the initial delay between them, doubled for each retry.
+    - ETOS_GRAPHQL_TOKEN: Bearer token to authenticate with.
+    - ETOS_GRAPHQL_USERNAME, ETOS_GRAPHQL_PASSWORD: Basic auth credentials.
+    - ETOS_GRAPHQL_CA_BUNDLE: CA bundle to verify the event repository certificate.
+    - ETOS_GRAPHQL_VERIFY: Set to 'false' to disable certificate verification.
+    - ETOS_GRAPHQL_CACHE_SIZE: Number of cached responses to immutable queries.
+    """
+
+    _cache = OrderedDict()
+
+    def __init__(  # pylint:disable=too-many-arguments
+        self,
+        etos,
+        url=None,
+        token=None,
+        username=None,
+        password=None,
+        ca_bundle=None,
+        verify=None,
+        timeout=None,
+        retries=None,
+        backoff=None,
+        cache_size=None,
+    ):
         """Initialize the async io transport.
 
+        Options that are not set are read from the environment variables.
+
         :param etos: ETOS Library instance.
         :type etos: :obj:`etos_lib.ETOS`
+        :param url: URL to the event repository GraphQL API.
+        :type url: str
+        :param token: Bearer token to authenticate with.
+        :type token: str
+        :param username: Username for basic auth.
+        :type username: str
+        :param password: Password for basic auth.
+        :type password: str
+        :param ca_bundle: Path to a CA bundle to verify the certificate with.
+        :type ca_bundle: str
+        :param verify: Whether or not to verify the certificate. Defaults to True.
+        :type verify: bool
+        :param timeout: Timeout for each query (seconds).
+        :type timeout: float
+        :param retries: Number of retries on server and connection errors.
+        :type retries: int
+        :param backoff: Delay before the first retry (seconds), doubled each retry.
+        :type backoff: float
+        :param cache_size: Maximum number of cached responses.
+        :type cache_size: int
         """
         self.etos = etos
+        self.url = _setting(url, "ETOS_GRAPHQL_URL", self.etos.debug.graphql_server)
+        self.retries = _setting(retries, "ETOS_GRAPHQL_RETRIES", 3, int)
+        self.backoff = _setting(backoff, "ETOS_GRAPHQL_BACKOFF", 1.0, float)
+        self.cache_size = _setting(cache_size, "ETOS_GRAPHQL_CACHE_SIZE", 1000, int)
+        timeout = _setting(timeout, "ETOS_GRAPHQL_TIMEOUT", None, float)
+        if timeout is not None:
+            self.http_timeout = self.wait_timeout = timeout
+        else:
+            self.http_timeout = self.etos.debug.default_http_timeout
+            self.wait_timeout = self.etos.debug.default_wait_timeout
+
+        transport_args = {}
+        token = _setting(token, "ETOS_GRAPHQL_TOKEN")
+        if token:
+            transport_args["headers"] = {"Authorization": f"Bearer {token}"}
+        username = _setting(username, "ETOS_GRAPHQL_USERNAME")
+        if username:
+            password = _setting(password, "ETOS_GRAPHQL_PASSWORD", "")
+            transport_args["auth"] = aiohttp.BasicAuth(username, password)
         self.transport = AIOHTTPTransport(
-            url=self.etos.debug.graphql_server,
-            timeout=self.etos.debug.default_http_timeout,
+            url=self.url,
+            timeout=self.http_timeout,
             client_session_args={"trust_env": True},
+            ssl=self._ssl(ca_bundle, verify),
+            **transport_args,
         )
 
-    async def execute(self, query):
-        """Execute a graphql query.
+    @staticmethod
+    def _ssl(ca_bundle, verify):
+        """Create the SSL argument for the transport.
+
+        The transport does not verify certificates unless it gets an SSL context.
+
+        :param ca_bundle: Path to a CA bundle to verify the certificate with.
+        :type ca_bundle: str
+        :param verify: Whether or not to verify the certificate.
+        :type verify: bool
+        :return: SSL context to verify with, or False to not verify.
+        :rtype: :obj:`ssl.SSLContext` or bool
+        """
+        verify = _setting(
+            verify, "ETOS_GRAPHQL_VERIFY", True, lambda env: env.lower() != "false"
+        )
+        if not verify:
+            LOGGER.warning("Certificate verification of the event repository is off.")
+            return False
+        return ssl.create_default_context(
+            cafile=_setting(ca_bundle, "ETOS_GRAPHQL_CA_BUNDLE")
+        )
+
+    @staticmethod
+    def _cacheable(response):
+        """Check whether a response has found what it was looking for.
+
+        Empty responses are never cached, since the event may not exist yet.
+
+        :param response: Response from GraphQL.
+        :type response: dict
+        :return: Whether or not the response can be cached.
+        :rtype: bool
+        """
+        return bool(response) and all(
+            value.get("edges") for value in response.values() if isinstance(value, dict)
+        )
+
+    async def _execute(self, query):
+        """Execute a graphql query once.
 
         :param query: Query to execute.
         :type query: str
-        :return: Response from GraphQL.
+        :return: Response from GraphQL. None if the query timed out.
         :rtype: dict
         """
-        async with Client(
+        async with timed("event-repository"), Client(
             transport=self.transport,
             fetch_schema_from_transport=True,
-            execute_timeout=self.etos.debug.default_wait_timeout,
+            execute_timeout=self.wait_timeout,
         ) as session:
             try:
                 return await session.execute(gql(query))
             except asyncio.exceptions.TimeoutError:
                 return None
+
+    async def execute(self, query, timeout=None, cache=False):
+        """Execute a graphql query, retrying on server and connection errors.
+
+        :param query: Query to execute.
+        :type query: str
+        :param timeout: Maximum time for the query including retries (seconds).
+        :type timeout: float
+        :param cache: Cache the response. Only use for queries on immutable data,
+                      e.g. events looked up by ID.
+        :type cache: bool
+        :return: Response from GraphQL. None if the query timed out.
+        :rtype: dict
+        """
+        if cache and query in self._cache:
+            self._cache.move_to_end(query)
+            return self._cache[query]
+        try:
+            response = await asyncio.wait_for(
+                self._execute_with_retries(query), timeout
+            )
+        except asyncio.TimeoutError:
+            return None
+        if cache and self._cacheable(response):
+            self._cache[query] = response
+            while len(self._cache) > self.cache_size:
+                self._cache.popitem(last=False)
+        return response
+
+    async def _execute_with_retries(self, query):
+        """Execute a graphql query with exponential backoff on failures.
+
+        Connection errors and server errors are retried, other errors are not.
+
+        :param query: Query to execute.
+        :type query: str
+        :return: Response from GraphQL. None if the query timed out.
+        :rtype: dict
+        """
+        return await retry(
+            lambda: self._execute(query),
+            Backoff(self.backoff, maximum=EXTERNAL_DEPENDENCY.maximum),
+            attempts=self.retries + 1,
+            retry_on=(aiohttp.ClientConnectionError, TransportServerError),
+            should_retry=self._should_retry,
+        )
+
+    @staticmethod
+    def _should_retry(exception):
+        """Check whether a failed query should be retried.
+
+        :param exception: Exception raised by the query.
+        :type exception: Exception
+        :return: True unless the server rejected the query as a client error.
+        :rtype: bool
+        """
+        LOGGER.warning("GraphQL query failed: %r", exception)
+        code = getattr(exception, "code", None)
+        return code is None or code >= 500
@@ -48,3 +48,82 @@ VERIFY_ARTIFACT_ID_EXISTS = """
   }
 }
 """
+
+ACTIVITY_TRIGGERED = """
+{
+  activityTriggered(search: "{'links.type': 'CAUSE', 'links.target': '%s'}", last: 1) {
+    edges {
+      node {
+        meta {
+          id
+        }
+      }
+    }
+  }
+}
+"""
+
+ACTIVITY_FINISHED = """
+{
+  activityFinished(search: "{'links.type': 'ACTIVITY_EXECUTION', 'links.target': '%s'}", last: 1) {
+    edges {
+      node {
+        data {
+          activityOutcome {
+            conclusion
+            description
+          }
+        }
+      }
+    }
+  }
+}
+"""
+
+ACTIVITY_CANCELED = """
+{
+  activityCanceled(search: "{'links.type': 'ACTIVITY_EXECUTION', 'links.target': '%s'}", last: 1) {
+    edges {
+      node {
+        data {
+          reason
+        }
+      }
+    }
+  }
+}
+"""
+
+TEST_SUITE_STARTED = """
+{
+  testSuiteStarted(search: "{'links.type': 'CAUSE', 'links.target': '%s'}", first: 100%s) {
+    pageInfo {
+      hasNextPage
+      endCursor
+    }
+    edges {
+      node {
+        meta {
+          id
+        }
+      }
+    }
+  }
+}
+"""
+
+TEST_SUITE_FINISHED = """
+{
+  testSuiteFinished(search: "{'links.type': 'TEST_SUITE_EXECUTION', 'links.target': '%s'}", last: 1) {
+    edges {
+      node {
+        data {
+          testSuiteOutcome {
+            verdict
+          }
+        }
+      }
+    }
+  }
+}
+"""
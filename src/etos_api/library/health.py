@@ -0,0 +1,257 @@
+# Copyright 2021 Axis Communications AB.
+#
+# For a full list of individual contributors, please see the commit history.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+"""ETOS API dependency health checks."""
+import asyncio
+import logging
+import os
+import time
+from uuid import uuid4
+import aiohttp
+
+from etos_api.library.graphql import GraphqlQueryHandler
+from etos_api.library.utilities import sync_to_async
+
+LOGGER = logging.getLogger(__name__)
+HEALTH_CHECK_TIMEOUT = float(os.getenv("ETOS_HEALTH_CHECK_TIMEOUT", "5"))
+
+OK = "ok"
+FAILED = "failed"
+SKIPPED = "skipped"
+
+
+def _result(name, status, start, detail=None):
+    """Create a check result dictionary.
+
+    :param name: Name of the check.
+    :type name: str
+    :param status: Status of the check. One of OK, FAILED or SKIPPED.
+    :type status: str
+    :param start: Monotonic time when the check started.
+    :type start: float
+    :param detail: Optional detail about the result.
+    :type detail: str
+    :return: Check result.
+    :rtype: dict
+    """
+    return {
+        "name": name,
+        "status": status,
+        "detail": detail,
+        "duration": time.monotonic() - start,
+    }
+
+
+async def check_http(name, url, timeout=HEALTH_CHECK_TIMEOUT):
+    """Check that an HTTP dependency is responding.
+
+    Any response below 500 is considered healthy since we only want to know
+    whether the service is up, not whether this particular request is valid.
+
+    :param name: Name of the dependency.
+    :type name: str
+    :param url: URL to send a GET request to.
+    :type url: str
+    :param timeout: Maximum time to wait for a response (seconds).
+    :type timeout: float
+    :return: Check result.
+    :rtype: dict
+    """
+    start = time.monotonic()
+    if not url:
+        return _result(name, FAILED, start, "No URL configured")
+    try:
+        async with aiohttp.ClientSession(
+            timeout=aiohttp.ClientTimeout(total=timeout), trust_env=True
+        ) as session:
+            async with session.get(url) as response:
+                if response.status >= 500:
+                    return _result(
+                        name, FAILED, start, f"HTTP {response.status} {response.reason}"
+                    )
+    except (aiohttp.ClientError, asyncio.TimeoutError) as exception:
+        LOGGER.warning("Health check of %r failed: %r", name, exception)
+        return _result(name, FAILED, start, str(exception) or type(exception).__name__)
+    return _result(name, OK, start)
+
+
+async def check_tcp(name, host, port, timeout=HEALTH_CHECK_TIMEOUT):
+    """Check that a TCP dependency accepts connections.
+
+    :param name: Name of the dependency.
+    :type name: str
+    :param host: Host to connect to.
+    :type host: str
+    :param port: Port to connect to.
+    :type port: int
+    :param timeout: Maximum time to wait for a connection (seconds).
+    :type timeout: float
+    :return: Check result.
+    :rtype: dict
+    """
+    start = time.monotonic()
+    try:
+        _, writer = await asyncio.wait_for(
+            asyncio.open_connection(host, port), timeout=timeout
+        )
+        writer.close()
+        await writer.wait_closed()
+    except (OSError, asyncio.TimeoutError) as exception:
+        LOGGER.warning("Health check of %r failed: %r", name, exception)
+        return _result(name, FAILED, start, str(exception) or type(exception).__name__)
+    return _result(name, OK, start)
+
+
+async def check_rabbitmq(etos_library):
+    """Check that the RabbitMQ server that events are published to is reachable.
+
+    :param etos_library: ETOS library instance.
+    :type etos_library: :obj:`etos_lib.ETOS`
+    :return: Check result.
+    :rtype: dict
+    """
+    start = time.monotonic()
+    if etos_library.debug.disable_sending_events:
+        return _result("rabbitmq", SKIPPED, start, "Sending events is disabled")
+    try:
+        await sync_to_async(etos_library.config.rabbitmq_publisher_from_environment)
+        config = etos_library.config.get("rabbitmq_publisher")
+    except Exception as exception:  # pylint:disable=broad-except
+        LOGGER.warning("Could not load the RabbitMQ configuration: %r", exception)
+        return _result(
+            "rabbitmq", FAILED, start, str(exception) or type(exception).__name__
+        )
+    if not config:
+        return _result("rabbitmq", SKIPPED, start, "RabbitMQ is not configured")
+    return await check_tcp("rabbitmq", config.get("host"), config.get("port", 5672))
+
+
+async def check_dependencies(etos_library):
+    """Check all dependencies of the ETOS API concurrently.
+
+    :param etos_library: ETOS library instance.
+    :type etos_library: :obj:`etos_lib.ETOS`
+    :return: Check results, one per dependency.
+    :rtype: list
+    """
+    return list(
+        await asyncio.gather(
+            check_http("event_repository", etos_library.debug.graphql_server),
+            check_http("environment_provider", etos_library.debug.environment_provider),
+            check_rabbitmq(etos_library),
+        )
+    )
+
+
+async def validate_dependencies(etos_library):
+    """Validate the configuration and dependencies of the ETOS API.
+
+    All dependencies are checked so that every problem can be reported at once.
+
+    :param etos_library: ETOS library instance.
+    :type etos_library: :obj:`etos_lib.ETOS`
+    :return: Description of each problem found. Empty if there are none.
+    :rtype: list
+    """
+    return [
+        f"{result['name']}: {result['detail']}"
+        for result in await check_dependencies(etos_library)
+        if result["status"] == FAILED
+    ]
+
+
+async def check_event_repository_query(etos_library, timeout=HEALTH_CHECK_TIMEOUT):
+    """Check that the event repository can execute GraphQL queries.
+
+    :param etos_library: ETOS library instance.
+    :type etos_library: :obj:`etos_lib.ETOS`
+    :param timeout: Maximum time to wait for the query (seconds).
+    :type timeout: float
+    :return: Check result.
+    :rtype: dict
+    """
+    start = time.monotonic()
+    try:
+        response = await asyncio.wait_for(
+            GraphqlQueryHandler(etos_library).execute("{ __typename }"), timeout
+        )
+    except asyncio.TimeoutError:
+        return _result("event_repository_query", FAILED, start, "Query timed out")
+    except Exception as exception:  # pylint:disable=broad-except
+        LOGGER.warning("GraphQL query to the event repository failed: %r", exception)
+        return _result(
+            "event_repository_query",
+            FAILED,
+            start,
+            str(exception) or type(exception).__name__,
+        )
+    if response is None:
+        return _result("event_repository_query", FAILED, start, "Query timed out")
+    return _result("event_repository_query", OK, start)
+
+
+async def check_environment_provider_configuration(
+    etos_library, timeout=HEALTH_CHECK_TIMEOUT
+):
+    """Check that the environment provider can look up configurations.
+
+    Makes the same request as when waiting for a configuration to apply, for a
+    random suite ID that is not expected to be configured.
+
+    :param etos_library: ETOS library instance.
+    :type etos_library: :obj:`etos_lib.ETOS`
+    :param timeout: Maximum time to wait for a response (seconds).
+    :type timeout: float
+    :return: Check result.
+    :rtype: dict
+    """
+    name = "environment_provider_configuration"
+    start = time.monotonic()
+    if not etos_library.debug.environment_provider:
+        return _result(name, FAILED, start, "No URL configured")
+    try:
+        async with aiohttp.ClientSession(
+            timeout=aiohttp.ClientTimeout(total=timeout), trust_env=True
+        ) as session:
+            async with session.get(
+                f"{etos_library.debug.environment_provider}/configure",
+                params={"suite_id": str(uuid4())},
+                headers={"Accept": "application/json"},
+            ) as response:
+                if response.status >= 400:
+                    return _result(
+                        name, FAILED, start, f"HTTP {response.status} {response.reason}"
+                    )
+                await response.json()
+    except (aiohttp.ClientError, asyncio.TimeoutError, ValueError) as exception:
+        LOGGER.warning("Configuration lookup in %r failed: %r", name, exception)
+        return _result(name, FAILED, start, str(exception) or type(exception).__name__)
+    return _result(name, OK, start)
+
+
+async def deep_checks(etos_library):
+    """Run all dependency checks plus functional checks of the ETOS API.
+
+    :param etos_library: ETOS library instance.
+    :type etos_library: :obj:`etos_lib.ETOS`
+    :return: Check results, one per check.
+    :rtype: list
+    """
+    checks = await asyncio.gather(
+        check_dependencies(etos_library),
+        check_event_repository_query(etos_library),
+        check_environment_provider_configuration(etos_library),
+    )
+    return checks[0] + list(checks[1:])
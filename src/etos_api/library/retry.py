@@ -0,0 +1,146 @@
+# Copyright 2021 Axis Communications AB.
+#
+# For a full list of individual contributors, please see the commit history.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+"""ETOS API retry and backoff helpers."""
+import asyncio
+import logging
+import random
+import time
+
+LOGGER = logging.getLogger(__name__)
+
+
+class Backoff:  # pylint:disable=too-few-public-methods
+    """Exponential backoff policy with jitter."""
+
+    def __init__(self, initial, maximum=None, multiplier=2.0, jitter=0.1):
+        """Initialize the policy.
+
+        :param initial: Delay before the first retry (seconds).
+        :type initial: float
+        :param maximum: Maximum delay between retries (seconds). None for no maximum.
+        :type maximum: float
+        :param multiplier: Factor to increase the delay with after each retry.
+        :type multiplier: float
+        :param jitter: Random fraction to add to or remove from each delay.
+        :type jitter: float
+        """
+        self.initial = initial
+        self.maximum = maximum
+        self.multiplier = multiplier
+        self.jitter = jitter
+
+    def delays(self):
+        """Generate the delays between retries.
+
+        :return: Generator of delays (seconds).
+        :rtype: generator
+        """
+        delay = self.initial
+        while True:
+            yield delay * random.uniform(1 - self.jitter, 1 + self.jitter)
+            delay *= self.multiplier
+            if self.maximum is not None:
+                delay = min(delay, self.maximum)
+
+
+# Short waits for things that are expected to be ready soon.
+FAST = Backoff(0.5, maximum=2)
+# Waits for events that may take a while to show up.
+SLOW = Backoff(2, maximum=10)
+# Requests to services that may be temporarily unavailable.
+EXTERNAL_DEPENDENCY = Backoff(1, maximum=30)
+
+
+class NotReady(Exception):
+    """Raised when a polled function has no result yet."""
+
+
+async def retry(  # pylint:disable=too-many-arguments
+    function,
+    policy,
+    attempts=None,
+    timeout=None,
+    retry_on=(Exception,),
+    should_retry=None,
+):
+    """Call a coroutine function until it does not raise.
+
+    The function is always called at least once. The last exception is
+    raised when there are no attempts or time left.
+
+    :param function: Coroutine function to call without arguments.
+    :type function: function
+    :param policy: Backoff policy to wait according to between attempts.
+    :type policy: :obj:`Backoff`
+    :param attempts: Maximum number of attempts. None for no maximum.
+    :type attempts: int
+    :param timeout: Maximum time to retry for (seconds). None for no maximum.
+    :type timeout: float
+    :param retry_on: Exceptions to retry on. Others are raised immediately.
+    :type retry_on: tuple
+    :param should_retry: Optional check whether a caught exception should be retried.
+    :type should_retry: function
+    :return: Return value of the function.
+    :rtype: any
+    """
+    end = None if timeout is None else time.monotonic() + timeout
+    delays = policy.delays()
+    attempt = 0
+    while True:
+        attempt += 1
+        try:
+            return await function()
+        except retry_on as exception:
+            if should_retry is not None and not should_retry(exception):
+                raise
+            if attempts is not None and attempt >= attempts:
+                raise
+            delay = next(delays)
+            if end is not None:
+                remaining = end - time.monotonic()
+                if remaining <= 0:
+                    raise
+                delay = min(delay, remaining)
+            LOGGER.debug(
+                "Attempt %d failed (%r), retrying in %.1fs.", attempt, exception, delay
+            )
+            await asyncio.sleep(delay)
+
+
+async def poll(function, policy, timeout):
+    """Call a coroutine function until it returns something other than None.
+
+    :param function: Coroutine function to call without arguments.
+    :type function: function
+    :param policy: Backoff policy to wait according to between polls.
+    :type policy: :obj:`Backoff`
+    :param timeout: Maximum time to poll for (seconds).
+    :type timeout: float
+    :return: Return value of the function. None if the timeout was reached.
+    :rtype: any
+    """
+
+    async def ready():
+        """Call the function and raise NotReady if there is no result yet."""
+        result = await function()
+        if result is None:
+            raise NotReady()
+        return result
+
+    try:
+        return await retry(ready, policy, timeout=timeout, retry_on=(NotReady,))
+    except NotReady:
+        return None
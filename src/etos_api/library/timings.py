@@ -0,0 +1,66 @@
+# Copyright 2021 Axis Communications AB.
+#
+# For a full list of individual contributors, please see the commit history.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+"""ETOS API per-request timing breakdown."""
+import time
+from contextvars import ContextVar
+from contextlib import asynccontextmanager
+
+DEBUG_HEADER = "X-Etos-Debug"
+TIMINGS_HEADER = "Server-Timing"
+TIMINGS = ContextVar("timings", default=None)
+
+
+def start_timings():
+    """Start collecting timings for the current request context.
+
+    :return: Dictionary that will be populated with timings, in seconds.
+    :rtype: dict
+    """
+    timings = {}
+    TIMINGS.set(timings)
+    return timings
+
+
+@asynccontextmanager
+async def timed(name):
+    """Measure the time spent in a block and add it to the request timings.
+
+    Does nothing unless :meth:`start_timings` has been called in this context.
+    Multiple blocks with the same name are summed up.
+
+    :param name: Name of the upstream or phase being measured.
+    :type name: str
+    """
+    timings = TIMINGS.get()
+    start = time.monotonic()
+    try:
+        yield
+    finally:
+        if timings is not None:
+            timings[name] = timings.get(name, 0.0) + (time.monotonic() - start)
+
+
+def format_timings(timings):
+    """Format timings as a 'Server-Timing' header value.
+
+    :param timings: Timings, in seconds, to format.
+    :type timings: dict
+    :return: Header value with durations in milliseconds.
+    :rtype: str
+    """
+    return ", ".join(
+        f"{name};dur={duration * 1000:.1f}" for name, duration in timings.items()
+    )
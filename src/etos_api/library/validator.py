@@ -19,6 +19,7 @@ from uuid import UUID
 from typing import Union, List
 from pydantic import BaseModel, validator, ValidationError, constr, conlist
 import requests
+from etos_api.library.timings import timed
 
 
 class Environment(BaseModel):
@@ -162,7 +163,8 @@ class SuiteValidator:  # pylint:disable=too-few-public-methods
         :rtype: list
         """
         try:
-            suite = requests.get(test_suite_url)
+            async with timed("test-suite"):
+                suite = requests.get(test_suite_url)
             suite.raise_for_status()
         except Exception as exception:  # pylint:disable=broad-except
             raise AssertionError(
@@ -15,13 +15,104 @@
 # limitations under the License.
 """ETOS API."""
 import logging
-from fastapi import FastAPI
+import os
+import time
+from fastapi import FastAPI, Request
+from fastapi.exceptions import RequestValidationError
+from starlette.exceptions import HTTPException
 from starlette.responses import RedirectResponse
+from etos_lib import ETOS
 from etos_api import routers
+from etos_api.library.client_ip import resolve_client_ip
+from etos_api.library.errors import (
+    http_exception_handler,
+    validation_exception_handler,
+    unhandled_exception_handler,
+)
+from etos_api.library.health import validate_dependencies
+from etos_api.library.timings import (
+    DEBUG_HEADER,
+    TIMINGS_HEADER,
+    start_timings,
+    format_timings,
+)
 
 
 APP = FastAPI()
+APP.add_exception_handler(HTTPException, http_exception_handler)
+APP.add_exception_handler(RequestValidationError, validation_exception_handler)
+APP.add_exception_handler(Exception, unhandled_exception_handler)
 LOGGER = logging.getLogger(__name__)
+VALIDATE_ON_STARTUP = os.getenv("VALIDATE_ON_STARTUP", "false").lower() == "true"
+
+
+@APP.on_event("startup")
+async def validate_on_startup():
+    """Validate configuration and dependencies before accepting requests.
+
+    Only enabled if the 'VALIDATE_ON_STARTUP' environment variable is 'true'.
+
+    :raises RuntimeError: If there are problems with configuration or dependencies.
+    """
+    if not VALIDATE_ON_STARTUP:
+        return
+    LOGGER.info("Validating configuration and dependencies.")
+    etos_library = ETOS("ETOS API", os.getenv("HOSTNAME"), "ETOS API")
+    problems = await validate_dependencies(etos_library)
+    for problem in problems:
+        LOGGER.critical(problem)
+    if problems:
+        raise RuntimeError(f"ETOS API validation failed: {problems}")
+    LOGGER.info("Configuration and dependencies validated.")
+
+
+@APP.middleware("http")
+async def debug_timings(request: Request, call_next):
+    """Add a timing breakdown to the response if requested via the debug header.
+
+    Send 'X-Etos-Debug: timings' to get a 'Server-Timing' header in the response
+    with the time spent in each upstream service as well as the total.
+
+    :param request: The incoming request.
+    :type request: :obj:`fastapi.Request`
+    :param call_next: Next handler in the middleware chain.
+    :type call_next: function
+    :return: Response from the next handler.
+    :rtype: :obj:`starlette.responses.Response`
+    """
+    debug = request.headers.get(DEBUG_HEADER, "").lower().split(",")
+    if "timings" not in [value.strip() for value in debug]:
+        return await call_next(request)
+    timings = start_timings()
+    start = time.monotonic()
+    response = await call_next(request)
+    timings["total"] = time.monotonic() - start
+    response.headers[TIMINGS_HEADER] = format_timings(timings)
+    return response
+
+
+@APP.middleware("http")
+async def client_ip(request: Request, call_next):
+    """Resolve the client IP from forwarding headers set by trusted proxies.
+
+    Trusted proxies are configured with the 'TRUSTED_PROXIES' environment variable
+    as a comma separated list of IP addresses or CIDRs. The resolved IP replaces
+    the client in the request scope and is added to every log record of the
+    request as 'client_ip'.
+
+    :param request: The incoming request.
+    :type request: :obj:`fastapi.Request`
+    :param call_next: Next handler in the middleware chain.
+    :type call_next: function
+    :return: Response from the next handler.
+    :rtype: :obj:`starlette.responses.Response`
+    """
+    peer, port = request.client if request.client else (None, 0)
+    address = resolve_client_ip(peer, request.headers)
+    if address != peer:
+        request.scope["client"] = (address, port)
+    LOGGER.client_ip.set(address)
+    return await call_next(request)
 
 
 @APP.post("/")
@@ -50,6 +141,20 @@ async def redirect_head_to_root():
     )  # 308 = Permanent Redirect
 
 
-APP.include_router(routers.etos.ROUTER)
-APP.include_router(routers.selftest.ROUTER)
-APP.include_router(routers.environment_provider.ROUTER)
+# Sub-applications mounted in the ETOS API and the dependencies they require.
+APPLICATIONS = {
+    "etos": (
+        routers.etos.ROUTER,
+        ["event_repository", "environment_provider", "rabbitmq"],
+    ),
+    "selftest": (routers.selftest.ROUTER, []),
+    "environment_provider": (
+        routers.environment_provider.ROUTER,
+        ["environment_provider"],
+    ),
+}
+for router, _ in APPLICATIONS.values():
+    APP.include_router(router)
+APP.state.applications = {
+    name: dependencies for name, (_, dependencies) in APPLICATIONS.items()
+}
@@ -15,17 +15,25 @@
 # limitations under the License.
 """Environment provider proxy API."""
 import logging
-import asyncio
 import os
-import time
 import aiohttp
-from fastapi import APIRouter, HTTPException
+from fastapi import APIRouter
 from etos_lib import ETOS
+from etos_api.library.errors import EtosError, ErrorResponse
+from etos_api.library.retry import retry, poll, NotReady, FAST, EXTERNAL_DEPENDENCY
+from etos_api.library.timings import timed
 
 from .schemas import ConfigureEnvironmentProviderRequest
 
 ROUTER = APIRouter()
 LOGGER = logging.getLogger(__name__)
+RETRY_AFTER = 10
+CONFIGURATION_KEYS = (
+    "dataset",
+    "iut_provider",
+    "log_area_provider",
+    "execution_space_provider",
+)
 
 
 async def _wait_for_configuration(etos_library, environment):
@@ -37,46 +45,52 @@ async def _wait_for_configuration(etos_library, environment):
     :type environment: :obj:`etos_api.routers.etos.schemas.ConfigureEnvironmentProviderRequest`
     """
     LOGGER.info("Waiting for configuration to be applied in the environment provider.")
-    end_time = time.time() + etos_library.debug.default_http_timeout
     LOGGER.debug("Timeout: %r", etos_library.debug.default_http_timeout)
     async with aiohttp.ClientSession() as session:
-        while time.time() < end_time:
-            try:
-                async with session.get(
-                    f"{etos_library.debug.environment_provider}/configure",
-                    params={"suite_id": environment.suite_id},
-                    headers={
-                        "Content-Type": "application/json",
-                        "Accept": "application/json",
-                    },
-                ) as response:
-                    assert 200 <= response.status < 400
-                    response_json = await response.json()
-                    LOGGER.info("Configuration: %r", response_json)
-                    assert response_json.get("dataset") is not None
-                    assert response_json.get("iut_provider") is not None
-                    assert response_json.get("log_area_provider") is not None
-                    assert response_json.get("execution_space_provider") is not None
-                break
-            except AssertionError:
-                if response.status < 400:
-                    LOGGER.warning("Configuration not ready yet.")
-                else:
+
+        async def configuration():
+            """Get the configuration, or None if it has not been applied yet."""
+            async with timed("environment-provider"), session.get(
+                f"{etos_library.debug.environment_provider}/configure",
+                params={"suite_id": environment.suite_id},
+                headers={
+                    "Content-Type": "application/json",
+                    "Accept": "application/json",
+                },
+            ) as response:
+                if not 200 <= response.status < 400:
                     LOGGER.warning(
                         "Configuration verification request failed: %r, %r",
                         response.status,
                         response.reason,
                     )
-                await asyncio.sleep(2)
-        else:
-            raise HTTPException(
-                status_code=400,
-                detail="Environment provider configuration did not apply properly",
-            )
+                    return None
+                response_json = await response.json()
+                LOGGER.info("Configuration: %r", response_json)
+                if any(response_json.get(key) is None for key in CONFIGURATION_KEYS):
+                    LOGGER.warning("Configuration not ready yet.")
+                    return None
+                return response_json
+
+        applied = await poll(
+            configuration, FAST, etos_library.debug.default_http_timeout
+        )
+    if applied is None:
+        raise EtosError(
+            status_code=503,
+            code="environment_provider_configuration_failed",
+            message="Environment provider configuration did not apply properly",
+            identifier=environment.suite_id,
+            retryable=True,
+            retry_after=RETRY_AFTER,
+        )
 
 
 @ROUTER.post(
-    "/environment_provider/configure", tags=["environment_provider"], status_code=204
+    "/environment_provider/configure",
+    tags=["environment_provider"],
+    status_code=204,
+    responses={503: {"model": ErrorResponse}},
 )
 async def configure_environment_provider(
     environment: ConfigureEnvironmentProviderRequest,
@@ -90,31 +104,42 @@ async def configure_environment_provider(
     LOGGER.info("Configuring environment provider using %r", environment)
     etos_library = ETOS("ETOS API", os.getenv("HOSTNAME"), "ETOS API")
 
-    end_time = time.time() + etos_library.debug.default_http_timeout
     LOGGER.debug("HTTP Timeout: %r", etos_library.debug.default_http_timeout)
     async with aiohttp.ClientSession() as session:
-        while time.time() < end_time:
-            try:
-                async with session.post(
-                    f"{etos_library.debug.environment_provider}/configure",
-                    json=environment.dict(),
-                    headers={
-                        "Content-Type": "application/json",
-                        "Accept": "application/json",
-                    },
-                ) as response:
-                    assert 200 <= response.status < 400
-                break
-            except AssertionError:
-                LOGGER.warning(
-                    "Configuration request failed: %r, %r",
-                    response.status,
-                    response.reason,
-                )
-                await asyncio.sleep(2)
-        else:
-            raise HTTPException(
-                status_code=400,
-                detail=f"Unable to configure environment provider with '{environment.json()}'",
+
+        async def configure():
+            """Send the configuration to the environment provider."""
+            async with timed("environment-provider"), session.post(
+                f"{etos_library.debug.environment_provider}/configure",
+                json=environment.dict(),
+                headers={
+                    "Content-Type": "application/json",
+                    "Accept": "application/json",
+                },
+            ) as response:
+                if not 200 <= response.status < 400:
+                    LOGGER.warning(
+                        "Configuration request failed: %r, %r",
+                        response.status,
+                        response.reason,
+                    )
+                    raise NotReady()
+
+        try:
+            await retry(
+                configure,
+                EXTERNAL_DEPENDENCY,
+                timeout=etos_library.debug.default_http_timeout,
+                retry_on=(NotReady,),
             )
+        except NotReady as exception:
+            raise EtosError(
+                status_code=503,
+                code="environment_provider_unavailable",
+                message="Unable to configure environment provider",
+                identifier=environment.suite_id,
+                retryable=True,
+                details=environment.dict(),
+                retry_after=RETRY_AFTER,
+            ) from exception
         await _wait_for_configuration(etos_library, environment)
@@ -15,29 +15,38 @@
 # limitations under the License.
 """ETOS API router."""
 import logging
-from uuid import uuid4
+from uuid import UUID, uuid4
 import os
 from fastapi import APIRouter, HTTPException
-from starlette.responses import Response
+from pydantic import ValidationError
 from etos_lib import ETOS
 from etos_lib.logging.logger import FORMAT_CONFIG
 from eiffellib.events import EiffelTestExecutionRecipeCollectionCreatedEvent
 
+from etos_api.library.errors import EtosError, ErrorResponse
 from etos_api.library.validator import SuiteValidator
 from etos_api.library.utilities import sync_to_async, aclosing
+from etos_api.library.timings import timed
 from etos_api.routers.environment_provider.router import configure_environment_provider
 from etos_api.routers.environment_provider.schemas import (
     ConfigureEnvironmentProviderRequest,
 )
-from .schemas import StartEtosRequest, StartEtosResponse
-from .utilities import wait_for_artifact_created
+from .schemas import StartEtosRequest, StartEtosResponse, WaitForTestrunResponse
+from .utilities import wait_for_artifact_created, wait_for_testrun, parse_duration
 
 ROUTER = APIRouter()
 LOGGER = logging.getLogger(__name__)
 logging.getLogger("pika").setLevel(logging.WARNING)
+RETRY_AFTER = 10
+MAX_WAIT_TIMEOUT = parse_duration(os.getenv("ETOS_MAX_WAIT_TIMEOUT", "1h"))
 
 
-@ROUTER.post("/etos", tags=["etos"], response_model=StartEtosResponse)
+@ROUTER.post(
+    "/etos",
+    tags=["etos"],
+    response_model=StartEtosResponse,
+    responses={400: {"model": ErrorResponse}, 503: {"model": ErrorResponse}},
+)
 async def start_etos(etos: StartEtosRequest):
     """Start ETOS execution on post.
 
@@ -48,14 +57,21 @@ async def start_etos(etos: StartEtosRequest):
     """
     tercc = EiffelTestExecutionRecipeCollectionCreatedEvent()
     LOGGER.identifier.set(tercc.meta.event_id)
+    LOGGER.info("ETOS start requested by %r", LOGGER.client_ip.get(None))
 
     LOGGER.info("Validating test suite.")
     try:
         await SuiteValidator().validate(etos.test_suite_url)
-    except AssertionError as exception:
+    except (AssertionError, ValidationError) as exception:
         LOGGER.error("Test suite validation failed!")
         LOGGER.error(exception)
-        return Response(status_code=400)
+        raise EtosError(
+            status_code=400,
+            code="invalid_test_suite",
+            message="Test suite validation failed",
+            identifier=tercc.meta.event_id,
+            details=str(exception),
+        ) from exception
     LOGGER.info("Test suite validated.")
 
     etos_library = ETOS("ETOS API", os.getenv("HOSTNAME"), "ETOS API")
@@ -70,13 +86,21 @@ async def start_etos(etos: StartEtosRequest):
         )
     except Exception as exception:  # pylint:disable=broad-except
         LOGGER.critical(exception)
-        raise HTTPException(
-            status_code=400, detail=f"Could not connect to GraphQL. {exception}"
+        raise EtosError(
+            status_code=503,
+            code="event_repository_unavailable",
+            message="Could not connect to GraphQL",
+            identifier=tercc.meta.event_id,
+            retryable=True,
+            details=str(exception),
+            retry_after=RETRY_AFTER,
         ) from exception
     if artifact is None:
-        raise HTTPException(
+        raise EtosError(
             status_code=400,
-            detail=f"Unable to find artifact with identity '{etos.artifact_identity or str(etos.artifact_id)}'",
+            code="artifact_not_found",
+            message=f"Unable to find artifact with identity '{etos.artifact_identity or str(etos.artifact_id)}'",
+            identifier=tercc.meta.event_id,
         )
     LOGGER.info("Found artifact created %r", artifact)
     # There are assumptions here. Since "edges" list is already tested
@@ -100,19 +124,30 @@ async def start_etos(etos: StartEtosRequest):
     )
     try:
         await configure_environment_provider(request)
+    except EtosError:
+        raise
     except Exception as exception:  # pylint:disable=broad-except
         LOGGER.critical(exception)
-        raise HTTPException(
-            status_code=400,
-            detail=f"Could not configure environment provider. {exception}",
+        details = (
+            exception.detail if isinstance(exception, HTTPException) else str(exception)
+        )
+        raise EtosError(
+            status_code=503,
+            code="environment_provider_unavailable",
+            message="Could not configure environment provider",
+            identifier=tercc.meta.event_id,
+            retryable=True,
+            details=details,
+            retry_after=RETRY_AFTER,
         ) from exception
     LOGGER.info("Environment provider configured.")
 
     LOGGER.info("Start event publisher.")
-    await sync_to_async(etos_library.start_publisher)
+    async with timed("rabbitmq"):
+        await sync_to_async(etos_library.start_publisher)
     LOGGER.info("Event published started successfully.")
     LOGGER.info("Publish TERCC event.")
-    async with aclosing(etos_library.publisher):
+    async with timed("rabbitmq"), aclosing(etos_library.publisher):
         event = etos_library.events.send(tercc, links, data)
     LOGGER.info("Event published.")
 
@@ -123,3 +158,52 @@ async def start_etos(etos: StartEtosRequest):
         "artifact_identity": identity,
         "event_repository": etos_library.debug.graphql_server,
     }
+
+
+@ROUTER.get(
+    "/etos/v1/testrun/{identifier}/wait",
+    tags=["etos"],
+    response_model=WaitForTestrunResponse,
+    responses={400: {"model": ErrorResponse}, 503: {"model": ErrorResponse}},
+)
+async def wait_for_testrun_completion(identifier: UUID, timeout: str = "30m"):
+    """Wait for an ETOS testrun to finish and return its verdict.
+
+    The timeout is capped by the 'ETOS_MAX_WAIT_TIMEOUT' environment variable.
+    If the testrun does not finish in time the status is 'TIMEOUT' and the
+    request can be repeated.
+
+    :param identifier: ID of the TERCC that started the testrun.
+    :type identifier: :obj:`uuid.UUID`
+    :param timeout: Maximum time to wait, e.g. '30m', '90s' or '1h'.
+    :type timeout: str
+    :return: JSON dictionary with response.
+    :rtype: dict
+    """
+    LOGGER.identifier.set(str(identifier))
+    try:
+        seconds = min(parse_duration(timeout), MAX_WAIT_TIMEOUT)
+    except ValueError as exception:
+        raise EtosError(
+            status_code=400,
+            code="invalid_timeout",
+            message=str(exception),
+            identifier=str(identifier),
+        ) from exception
+    LOGGER.info("Waiting %ss for testrun to finish.", seconds)
+
+    etos_library = ETOS("ETOS API", os.getenv("HOSTNAME"), "ETOS API")
+    try:
+        result = await wait_for_testrun(etos_library, str(identifier), seconds)
+    except Exception as exception:  # pylint:disable=broad-except
+        LOGGER.critical(exception)
+        raise EtosError(
+            status_code=503,
+            code="event_repository_unavailable",
+            message="Could not connect to GraphQL",
+            identifier=str(identifier),
+            retryable=True,
+            details=str(exception),
+            retry_after=RETRY_AFTER,
+        ) from exception
+    return {"tercc": identifier, **result}
@@ -66,3 +66,13 @@ class StartEtosResponse(BaseModel):
     tercc: UUID
     artifact_id: UUID
     artifact_identity: str
+
+
+class WaitForTestrunResponse(BaseModel):
+    """Response model for the ETOS wait for testrun API."""
+
+    tercc: UUID
+    status: str
+    conclusion: Optional[str]
+    verdict: Optional[str]
+    description: Optional[str]
@@ -15,15 +15,26 @@
 # limitations under the License.
 """Utilities specific for the ETOS endpoint."""
 import logging
-import asyncio
+import os
+import re
 import time
 from etos_api.library.graphql import GraphqlQueryHandler
+from etos_api.library.retry import poll, Backoff, SLOW
 from etos_api.library.graphql_queries import (
     ARTIFACT_IDENTITY_QUERY,
     VERIFY_ARTIFACT_ID_EXISTS,
+    ACTIVITY_TRIGGERED,
+    ACTIVITY_FINISHED,
+    ACTIVITY_CANCELED,
+    TEST_SUITE_STARTED,
+    TEST_SUITE_FINISHED,
 )
 
 LOGGER = logging.getLogger(__name__)
+WAIT_POLL_INTERVAL = float(os.getenv("ETOS_WAIT_POLL_INTERVAL", "10"))
+DURATION_UNITS = {"": 1, "s": 1, "m": 60, "h": 3600}
+# Verdicts ordered from worst to best.
+VERDICTS = ["FAILED", "INCONCLUSIVE", "PASSED"]
 
 
 async def wait_for_artifact_created(
@@ -42,7 +53,7 @@ async def wait_for_artifact_created(
     :return: ArtifactCreated edges from GraphQL.
     :rtype: list
     """
-    timeout = time.time() + timeout
+    end = time.time() + timeout
     query_handler = GraphqlQueryHandler(etos_library)
     if artifact_id is not None:
         LOGGER.info("Verify that artifact ID %r exists.", artifact_id)
@@ -55,14 +66,178 @@ async def wait_for_artifact_created(
     artifact_identifier = artifact_identity or str(artifact_id)
 
     LOGGER.debug("Wait for artifact created event.")
-    while time.time() < timeout:
-        try:
-            artifacts = await query_handler.execute(query % artifact_identifier)
-            assert artifacts is not None
-            assert artifacts["artifactCreated"]["edges"]
-            return artifacts["artifactCreated"]["edges"]
-        except (AssertionError, KeyError):
+
+    async def artifact_created():
+        """Get the artifact created edges, or None if there are none yet."""
+        artifacts = _edges(
+            await query_handler.execute(
+                query % artifact_identifier,
+                timeout=end - time.time(),
+                cache=artifact_id is not None,
+            ),
+            "artifactCreated",
+        )
+        if not artifacts:
             LOGGER.warning("Artifact created not ready yet")
-        await asyncio.sleep(2)
-    LOGGER.error("Artifact %r not found.", artifact_identifier)
-    return None
+            return None
+        return artifacts
+
+    artifacts = await poll(artifact_created, SLOW, timeout)
+    if artifacts is None:
+        LOGGER.error("Artifact %r not found.", artifact_identifier)
+    return artifacts
+
+
+def parse_duration(duration):
+    """Parse a duration such as '30m', '90s', '1h' or '600' into seconds.
+
+    :param duration: Duration to parse. Plain numbers are seconds.
+    :type duration: str
+    :return: Duration in seconds.
+    :rtype: float
+    :raises ValueError: If the duration could not be parsed.
+    """
+    match = re.fullmatch(r"(\d+(?:\.\d+)?)([smh]?)", duration.strip().lower())
+    if match is None:
+        raise ValueError(f"Invalid duration {duration!r}, expected e.g. '30m'.")
+    value, unit = match.groups()
+    return float(value) * DURATION_UNITS[unit]
+
+
+def _edges(response, event):
+    """Get the edges of an event from a GraphQL response.
+
+    :param response: Response from GraphQL. None if the query timed out.
+    :type response: dict
+    :param event: Name of the event queried, e.g. 'activityFinished'.
+    :type event: str
+    :return: Edges of the event. Empty if no event was found.
+    :rtype: list
+    """
+    if response is None:
+        return []
+    return (response.get(event) or {}).get("edges") or []
+
+
+def _verdict(verdicts):
+    """Aggregate test suite verdicts into a single verdict.
+
+    :param verdicts: Verdicts of each test suite.
+    :type verdicts: list
+    :return: The worst verdict. None if there are no verdicts.
+    :rtype: str
+    """
+    known = [verdict for verdict in verdicts if verdict in VERDICTS]
+    if not known:
+        return None
+    return min(known, key=VERDICTS.index)
+
+
+async def _test_suites_started(query_handler, tercc_id):
+    """Get all test suites started by a testrun, one page at a time.
+
+    :param query_handler: Handler to query the event repository with.
+    :type query_handler: :obj:`etos_api.library.graphql.GraphqlQueryHandler`
+    :param tercc_id: ID of the TERCC that started the testrun.
+    :type tercc_id: str
+    :return: TestSuiteStarted edges.
+    :rtype: list
+    """
+    suites = []
+    after = ""
+    while True:
+        response = await query_handler.execute(TEST_SUITE_STARTED % (tercc_id, after))
+        suites += _edges(response, "testSuiteStarted")
+        page_info = ((response or {}).get("testSuiteStarted") or {}).get("pageInfo")
+        if not page_info or not page_info.get("hasNextPage"):
+            return suites
+        after = f', after: "{page_info["endCursor"]}"'
+
+
+async def testrun_result(query_handler, tercc_id):
+    """Get the result of a testrun from the event repository.
+
+    :param query_handler: Handler to query the event repository with.
+    :type query_handler: :obj:`etos_api.library.graphql.GraphqlQueryHandler`
+    :param tercc_id: ID of the TERCC that started the testrun.
+    :type tercc_id: str
+    :return: Result of the testrun. None if it has not finished yet.
+    :rtype: dict
+    """
+    activity = _edges(
+        await query_handler.execute(ACTIVITY_TRIGGERED % tercc_id, cache=True),
+        "activityTriggered",
+    )
+    if not activity:
+        return None
+    activity_id = activity[0]["node"]["meta"]["id"]
+
+    canceled = _edges(
+        await query_handler.execute(ACTIVITY_CANCELED % activity_id, cache=True),
+        "activityCanceled",
+    )
+    if canceled:
+        return {
+            "status": "CANCELED",
+            "description": canceled[0]["node"]["data"].get("reason"),
+        }
+
+    finished = _edges(
+        await query_handler.execute(ACTIVITY_FINISHED % activity_id, cache=True),
+        "activityFinished",
+    )
+    if not finished:
+        return None
+    outcome = finished[0]["node"]["data"]["activityOutcome"]
+
+    verdicts = []
+    for suite in await _test_suites_started(query_handler, tercc_id):
+        suite_finished = _edges(
+            await query_handler.execute(
+                TEST_SUITE_FINISHED % suite["node"]["meta"]["id"], cache=True
+            ),
+            "testSuiteFinished",
+        )
+        if suite_finished:
+            verdicts.append(
+                suite_finished[0]["node"]["data"]["testSuiteOutcome"].get("verdict")
+            )
+    return {
+        "status": "FINISHED",
+        "conclusion": outcome.get("conclusion"),
+        "description": outcome.get("description"),
+        "verdict": _verdict(verdicts),
+    }
+
+
+async def wait_for_testrun(
+    etos_library, tercc_id, timeout, interval=WAIT_POLL_INTERVAL
+):
+    """Wait for a testrun to finish or be canceled.
+
+    :param etos_library: ETOS library instance.
+    :type etos_library: :obj:`etos_lib.etos.ETOS`
+    :param tercc_id: ID of the TERCC that started the testrun.
+    :type tercc_id: str
+    :param timeout: Maximum time to wait for the testrun (seconds).
+    :type timeout: float
+    :param interval: Time between polls of the event repository (seconds).
+    :type interval: float
+    :return: Result of the testrun. Status is 'TIMEOUT' if it did not finish in time.
+    :rtype: dict
+    """
+    query_handler = GraphqlQueryHandler(etos_library)
+
+    async def finished():
+        """Get the result of the testrun, or None if it has not finished yet."""
+        result = await testrun_result(query_handler, tercc_id)
+        if result is None:
+            LOGGER.debug("Testrun %r not finished yet.", tercc_id)
+        return result
+
+    result = await poll(finished, Backoff(interval, multiplier=1), timeout)
+    if result is None:
+        LOGGER.warning("Testrun %r did not finish in time.", tercc_id)
+        return {"status": "TIMEOUT"}
+    LOGGER.info("Testrun %r result: %r", tercc_id, result)
+    return result
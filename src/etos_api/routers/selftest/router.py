@@ -15,8 +15,14 @@
 # limitations under the License.
 """ETOS API selftest router."""
 import logging
+import os
 from starlette.responses import Response
-from fastapi import APIRouter
+from fastapi import APIRouter, Request
+from etos_lib import ETOS
+
+from etos_api import VERSION
+from etos_api.library.health import check_dependencies, deep_checks, FAILED
+from .schemas import StatusResponse, DeepSelftestResponse
 
 ROUTER = APIRouter()
 LOGGER = logging.getLogger(__name__)
@@ -37,3 +43,81 @@ async def head_ping():
     """Exists solely for backwards compatibility. DEPRECATED."""
     LOGGER.warning("DEPRECATED HEAD request to ping received!")
     return Response(status_code=204)
+
+
+@ROUTER.get(
+    "/selftest/deep",
+    tags=["maintenance"],
+    response_model=DeepSelftestResponse,
+    responses={503: {"model": DeepSelftestResponse}},
+)
+async def deep_selftest(response: Response):
+    """Run an end-to-end selftest of the ETOS API and its dependencies.
+
+    Checks that dependencies are reachable, that the event repository can
+    execute queries and that the environment provider can look up configurations.
+
+    :param response: Response to set the status code on.
+    :type response: :obj:`starlette.responses.Response`
+    :return: Report with the result of each check.
+    :rtype: dict
+    """
+    etos_library = ETOS("ETOS API", os.getenv("HOSTNAME"), "ETOS API")
+    checks = await deep_checks(etos_library)
+    failed = [check["name"] for check in checks if check["status"] == FAILED]
+    if failed:
+        LOGGER.error("Deep selftest failed: %r", failed)
+        response.status_code = 503
+    return {"status": FAILED if failed else "ok", "checks": checks}
+
+
+@ROUTER.get("/statusz", tags=["maintenance"], response_model=StatusResponse)
+async def statusz(request: Request):
+    """Aggregate the status of all sub-applications and their dependencies.
+
+    The sub-applications and their dependencies are read from the
+    'applications' state of the application that the router is included in.
+    A sub-application is 'ok' if all of its dependencies are healthy, 'down' if
+    none of them are and 'degraded' otherwise. The ETOS API as a whole is 'ok'
+    if all sub-applications are, 'partial' if any of them is down and
+    'degraded' otherwise.
+
+    :param request: The incoming request.
+    :type request: :obj:`fastapi.Request`
+    :return: Status document.
+    :rtype: dict
+    """
+    etos_library = ETOS("ETOS API", os.getenv("HOSTNAME"), "ETOS API")
+    dependencies = await check_dependencies(etos_library)
+    failed = {
+        dependency["name"]
+        for dependency in dependencies
+        if dependency["status"] == FAILED
+    }
+
+    applications = []
+    for name, required in request.app.state.applications.items():
+        failing = [dependency for dependency in required if dependency in failed]
+        if not failing:
+            status = "ok"
+        elif len(failing) == len(required):
+            status = "down"
+        else:
+            status = "degraded"
+        applications.append({"name": name, "status": status, "dependencies": required})
+
+    statuses = {application["status"] for application in applications}
+    if statuses == {"ok"}:
+        status = "ok"
+    elif "down" in statuses:
+        status = "partial"
+    else:
+        status = "degraded"
+    if status != "ok":
+        LOGGER.warning("ETOS API status is %r. Failing: %r", status, sorted(failed))
+    return {
+        "status": status,
+        "version": VERSION,
+        "applications": applications,
+        "dependencies": dependencies,
+    }
@@ -14,3 +14,42 @@
 # See the License for the specific language governing permissions and
 # limitations under the License.
 """Schemas for the selftest endpoint."""
+from typing import List, Optional
+from pydantic import BaseModel
+
+# There's a bug with pylint detecting subscription on Optional objects as problematic.
+# https://github.com/PyCQA/pylint/issues/3882
+# pylint: disable=unsubscriptable-object
+
+
+class DependencyStatus(BaseModel):
+    """Status of a single dependency of the ETOS API."""
+
+    name: str
+    status: str
+    detail: Optional[str]
+    duration: float
+
+
+class ApplicationStatus(BaseModel):
+    """Status of a sub-application of the ETOS API."""
+
+    name: str
+    status: str
+    dependencies: List[str]
+
+
+class StatusResponse(BaseModel):
+    """Response model for the statusz API."""
+
+    status: str
+    version: str
+    applications: List[ApplicationStatus]
+    dependencies: List[DependencyStatus]
+
+
+class DeepSelftestResponse(BaseModel):
+    """Response model for the deep selftest API."""
+
+    status: str
+    checks: List[DependencyStatus]
@@ -0,0 +1,44 @@
+# Copyright 2021 Axis Communications AB.
+#
+# For a full list of individual contributors, please see the commit history.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+"""Validate ETOS API configuration and dependencies without starting the API.
+
+Usage: python -m etos_api.validate
+"""
+import asyncio
+import logging
+import os
+import sys
+from etos_lib import ETOS
+
+from etos_api.library.health import validate_dependencies
+
+LOGGER = logging.getLogger(__name__)
+
+
+def main():
+    """Validate configuration and dependencies and exit non-zero on problems."""
+    etos_library = ETOS("ETOS API", os.getenv("HOSTNAME"), "ETOS API")
+    problems = asyncio.run(validate_dependencies(etos_library))
+    for problem in problems:
+        LOGGER.error(problem)
+    if problems:
+        LOGGER.critical("ETOS API validation failed with %d problem(s).", len(problems))
+        sys.exit(1)
+    LOGGER.info("ETOS API configuration and dependencies validated.")
+
+
+if __name__ == "__main__":
+    main()
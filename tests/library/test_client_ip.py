@@ -0,0 +1,206 @@
+# Copyright 2021 Axis Communications AB.
+#
+# For a full list of individual contributors, please see the commit history.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+"""Tests for the client IP library."""
+import logging
+import sys
+from unittest.mock import patch
+from fastapi import FastAPI, Request
+from fastapi.testclient import TestClient
+from starlette.datastructures import Headers
+from etos_api.library.client_ip import parse_networks, resolve_client_ip
+from etos_api.main import APP, client_ip
+
+logging.basicConfig(level=logging.DEBUG, stream=sys.stdout)
+
+
+class TestClientIp:
+    """Test the client IP library."""
+
+    logger = logging.getLogger(__name__)
+    trusted_proxies = parse_networks("10.0.0.0/8, 192.168.1.1")
+
+    def test_untrusted_peer(self):
+        """Test that forwarding headers from untrusted peers are ignored.
+
+        Approval criteria:
+            - The peer address shall be used if the peer is not a trusted proxy.
+
+        Test steps::
+            1. Resolve client IP for an untrusted peer with forwarding headers.
+            2. Verify that the peer address is returned.
+        """
+        headers = Headers({"X-Forwarded-For": "1.2.3.4", "X-Real-IP": "1.2.3.4"})
+        self.logger.info(
+            "STEP: Resolve client IP for an untrusted peer with forwarding headers."
+        )
+        address = resolve_client_ip("172.16.0.1", headers, self.trusted_proxies)
+        self.logger.info("STEP: Verify that the peer address is returned.")
+        assert address == "172.16.0.1"
+
+    def test_forwarded_for(self):
+        """Test that X-Forwarded-For is resolved from the right.
+
+        Approval criteria:
+            - The rightmost untrusted address in X-Forwarded-For shall be used.
+
+        Test steps::
+            1. Resolve client IP with a spoofed entry and trusted proxies.
+            2. Verify that the rightmost untrusted address is returned.
+        """
+        headers = Headers(
+            {"X-Forwarded-For": "6.6.6.6, 1.2.3.4, 192.168.1.1, 10.1.2.3"}
+        )
+        self.logger.info(
+            "STEP: Resolve client IP with a spoofed entry and trusted proxies."
+        )
+        address = resolve_client_ip("10.0.0.1", headers, self.trusted_proxies)
+        self.logger.info(
+            "STEP: Verify that the rightmost untrusted address is returned."
+        )
+        assert address == "1.2.3.4"
+
+    def test_real_ip(self):
+        """Test that X-Real-IP is used when there is no X-Forwarded-For.
+
+        Approval criteria:
+            - X-Real-IP from a trusted proxy shall be used without X-Forwarded-For.
+            - The peer address shall be used if there are no forwarding headers.
+
+        Test steps::
+            1. Resolve client IP from a trusted proxy with X-Real-IP.
+            2. Verify that the X-Real-IP address is returned.
+            3. Resolve client IP from a trusted proxy without forwarding headers.
+            4. Verify that the peer address is returned.
+        """
+        self.logger.info("STEP: Resolve client IP from a trusted proxy with X-Real-IP.")
+        address = resolve_client_ip(
+            "10.0.0.1", Headers({"X-Real-IP": "1.2.3.4"}), self.trusted_proxies
+        )
+        self.logger.info("STEP: Verify that the X-Real-IP address is returned.")
+        assert address == "1.2.3.4"
+        self.logger.info(
+            "STEP: Resolve client IP from a trusted proxy without forwarding headers."
+        )
+        address = resolve_client_ip("10.0.0.1", Headers(), self.trusted_proxies)
+        self.logger.info("STEP: Verify that the peer address is returned.")
+        assert address == "10.0.0.1"
+
+    def test_multiple_forwarded_for_headers(self):
+        """Test that multiple X-Forwarded-For headers are treated as one list.
+
+        Approval criteria:
+            - Entries added by a proxy in a separate header line shall be walked.
+
+        Test steps::
+            1. Resolve client IP with X-Forwarded-For split over two headers.
+            2. Verify that the rightmost untrusted address is returned.
+        """
+        headers = Headers(
+            raw=[
+                (b"x-forwarded-for", b"6.6.6.6, 1.2.3.4"),
+                (b"x-forwarded-for", b"5.6.7.8, 10.1.2.3"),
+            ]
+        )
+        self.logger.info(
+            "STEP: Resolve client IP with X-Forwarded-For split over two headers."
+        )
+        address = resolve_client_ip("10.0.0.1", headers, self.trusted_proxies)
+        self.logger.info(
+            "STEP: Verify that the rightmost untrusted address is returned."
+        )
+        assert address == "5.6.7.8"
+
+    def test_invalid_forwarded_addresses(self):
+        """Test that forwarded values that are not IP addresses are rejected.
+
+        Approval criteria:
+            - The peer address shall be used if the forwarded address is invalid.
+
+        Test steps::
+            1. Resolve client IP with invalid X-Forwarded-For and X-Real-IP values.
+            2. Verify that the peer address is returned for each value.
+        """
+        invalid = [
+            {"X-Forwarded-For": "unknown"},
+            {"X-Forwarded-For": "1.2.3.4:5678"},
+            {"X-Forwarded-For": "1.2.3.4, _hidden"},
+            {"X-Real-IP": "<script>"},
+        ]
+        self.logger.info(
+            "STEP: Resolve client IP with invalid X-Forwarded-For and X-Real-IP values."
+        )
+        addresses = [
+            resolve_client_ip("10.0.0.1", Headers(headers), self.trusted_proxies)
+            for headers in invalid
+        ]
+        self.logger.info(
+            "STEP: Verify that the peer address is returned for each value."
+        )
+        assert addresses == ["10.0.0.1"] * len(invalid)
+
+    @patch("etos_api.library.client_ip.TRUSTED_PROXIES", parse_networks("10.0.0.0/8"))
+    def test_client_ip_middleware(self, caplog):
+        """Test that the middleware sets the client IP on requests via a proxy.
+
+        Approval criteria:
+            - The ETOS API shall use the client IP middleware.
+            - The resolved client IP shall be used as request client.
+            - The resolved client IP shall be added to the log records of the request.
+
+        Test steps::
+            1. Verify that the client IP middleware is installed in the ETOS API.
+            2. Send a request via a trusted proxy with X-Forwarded-For.
+            3. Verify that the client and the log records have the forwarded IP.
+        """
+        self.logger.info(
+            "STEP: Verify that the client IP middleware is installed in the ETOS API."
+        )
+        assert any(
+            middleware.options.get("dispatch") is client_ip
+            for middleware in APP.user_middleware
+        )
+
+        app = FastAPI()
+        app.middleware("http")(client_ip)
+
+        @app.get("/client")
+        async def get_client(request: Request):
+            """Log a message and return the client of the request."""
+            self.logger.info("Client request")
+            return {"client": request.client.host}
+
+        async def via_proxy(scope, receive, send):
+            """Send the request as if it came from a trusted proxy."""
+            scope["client"] = ("10.0.0.1", 1234)
+            await app(scope, receive, send)
+
+        self.logger.info(
+            "STEP: Send a request via a trusted proxy with X-Forwarded-For."
+        )
+        response = TestClient(via_proxy).get(
+            "/client", headers={"X-Forwarded-For": "1.2.3.4"}
+        )
+        self.logger.info(
+            "STEP: Verify that the client and the log records have the forwarded IP."
+        )
+        assert response.json() == {"client": "1.2.3.4"}
+        records = [
+            record
+            for record in caplog.records
+            if record.getMessage() == "Client request"
+        ]
+        assert records
+        assert records[0].client_ip == "1.2.3.4"
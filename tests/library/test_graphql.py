@@ -0,0 +1,181 @@
+# Copyright 2021 Axis Communications AB.
+#
+# For a full list of individual contributors, please see the commit history.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+"""Tests for the graphql library."""
+import logging
+import ssl
+import sys
+from unittest.mock import MagicMock, patch
+import aiohttp
+import pytest
+from gql.transport.exceptions import TransportQueryError, TransportServerError
+from etos_api.library.graphql import GraphqlQueryHandler
+
+logging.basicConfig(level=logging.DEBUG, stream=sys.stdout)
+
+
+class TestGraphql:
+    """Test the graphql library."""
+
+    logger = logging.getLogger(__name__)
+    # Mark all test methods as asyncio methods to tell pytest to 'await' them.
+    pytestmark = pytest.mark.asyncio
+
+    def setup_method(self):
+        """Clear the query cache between tests."""
+        GraphqlQueryHandler._cache.clear()  # pylint:disable=protected-access
+
+    @patch.object(GraphqlQueryHandler, "_execute")
+    async def test_retry_on_server_error(self, execute_mock):
+        """Test that queries are retried on server and connection errors.
+
+        Approval criteria:
+            - Queries shall be retried until they succeed.
+
+        Test steps::
+            1. Execute a query that fails twice before succeeding.
+            2. Verify that the successful response is returned.
+        """
+        response = {"activityTriggered": {"edges": []}}
+        execute_mock.side_effect = [
+            TransportServerError("Internal Server Error"),
+            aiohttp.ClientConnectionError("Connection refused"),
+            response,
+        ]
+        handler = GraphqlQueryHandler(MagicMock(), retries=3, backoff=0)
+        self.logger.info("STEP: Execute a query that fails twice before succeeding.")
+        result = await handler.execute("{ activityTriggered { edges { } } }")
+        self.logger.info("STEP: Verify that the successful response is returned.")
+        assert result == response
+        assert execute_mock.call_count == 3
+
+    @patch.object(GraphqlQueryHandler, "_execute")
+    async def test_give_up_after_retries(self, execute_mock):
+        """Test that the last error is raised when all retries have failed.
+
+        Approval criteria:
+            - Queries shall not be retried more than the configured number of times.
+
+        Test steps::
+            1. Execute a query that always fails.
+            2. Verify that the error is raised after all retries.
+        """
+        execute_mock.side_effect = TransportServerError("Bad Gateway")
+        handler = GraphqlQueryHandler(MagicMock(), retries=2, backoff=0)
+        self.logger.info("STEP: Execute a query that always fails.")
+        with pytest.raises(TransportServerError):
+            await handler.execute("{ __typename }")
+        self.logger.info("STEP: Verify that the error is raised after all retries.")
+        assert execute_mock.call_count == 3
+
+    @patch.object(GraphqlQueryHandler, "_execute")
+    async def test_no_retry_on_query_error(self, execute_mock):
+        """Test that invalid queries are not retried.
+
+        Approval criteria:
+            - Query errors shall be raised without retrying.
+
+        Test steps::
+            1. Execute an invalid query.
+            2. Verify that the query was only executed once.
+        """
+        execute_mock.side_effect = TransportQueryError("Cannot query field")
+        handler = GraphqlQueryHandler(MagicMock(), retries=3, backoff=0)
+        self.logger.info("STEP: Execute an invalid query.")
+        with pytest.raises(TransportQueryError):
+            await handler.execute("{ invalid }")
+        self.logger.info("STEP: Verify that the query was only executed once.")
+        assert execute_mock.call_count == 1
+
+    @patch.object(GraphqlQueryHandler, "_execute")
+    async def test_cache_immutable_events(self, execute_mock):
+        """Test that responses to cached queries are only fetched once.
+
+        Approval criteria:
+            - Found events shall be served from the cache when caching is requested.
+
+        Test steps::
+            1. Execute the same cached query twice.
+            2. Verify that the event repository was only queried once.
+        """
+        response = {"artifactCreated": {"edges": [{"node": {"meta": {"id": "1"}}}]}}
+        execute_mock.return_value = response
+        handler = GraphqlQueryHandler(MagicMock())
+        self.logger.info("STEP: Execute the same cached query twice.")
+        first = await handler.execute("{ artifactCreated(id: 1) }", cache=True)
+        second = await handler.execute("{ artifactCreated(id: 1) }", cache=True)
+        self.logger.info("STEP: Verify that the repository was only queried once.")
+        assert first == second == response
+        assert execute_mock.call_count == 1
+
+    @patch.object(GraphqlQueryHandler, "_execute")
+    async def test_no_cache_of_empty_response(self, execute_mock):
+        """Test that events that are not found yet are not cached.
+
+        Approval criteria:
+            - Empty responses shall never be cached.
+
+        Test steps::
+            1. Execute a cached query that finds nothing, then finds the event.
+            2. Verify that the event is returned.
+        """
+        response = {"artifactCreated": {"edges": [{"node": {"meta": {"id": "2"}}}]}}
+        execute_mock.side_effect = [{"artifactCreated": {"edges": []}}, response]
+        handler = GraphqlQueryHandler(MagicMock())
+        self.logger.info(
+            "STEP: Execute a cached query that finds nothing, then finds the event."
+        )
+        await handler.execute("{ artifactCreated(id: 2) }", cache=True)
+        result = await handler.execute("{ artifactCreated(id: 2) }", cache=True)
+        self.logger.info("STEP: Verify that the event is returned.")
+        assert result == response
+
+    def test_client_options(self):
+        """Test that authentication and TLS options are passed to the transport.
+
+        Approval criteria:
+            - Token and basic auth shall be sent to the event repository.
+            - Certificates shall be verified unless verification is disabled.
+
+        Test steps::
+            1. Create a handler with a token.
+            2. Verify that the token is sent and certificates are verified.
+            3. Create a handler with basic auth and verification disabled.
+            4. Verify that basic auth is used and certificates are not verified.
+        """
+        self.logger.info("STEP: Create a handler with a token.")
+        handler = GraphqlQueryHandler(
+            MagicMock(), url="https://graphql", token="secret", timeout=5
+        )
+        self.logger.info(
+            "STEP: Verify that the token is sent and certificates are verified."
+        )
+        assert handler.transport.url == "https://graphql"
+        assert handler.transport.headers == {"Authorization": "Bearer secret"}
+        assert isinstance(handler.transport.ssl, ssl.SSLContext)
+        assert handler.transport.ssl.verify_mode == ssl.CERT_REQUIRED
+        assert handler.wait_timeout == 5
+
+        self.logger.info(
+            "STEP: Create a handler with basic auth and verification disabled."
+        )
+        handler = GraphqlQueryHandler(
+            MagicMock(), username="user", password="pass", verify=False
+        )
+        self.logger.info(
+            "STEP: Verify that basic auth is used and certificates are not verified."
+        )
+        assert handler.transport.auth == aiohttp.BasicAuth("user", "pass")
+        assert handler.transport.ssl is False
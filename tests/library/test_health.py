@@ -0,0 +1,256 @@
+# Copyright 2021 Axis Communications AB.
+#
+# For a full list of individual contributors, please see the commit history.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+"""Tests for the health library."""
+import asyncio
+import logging
+import sys
+from unittest.mock import AsyncMock, MagicMock, patch
+import pytest
+from etos_api.library.health import (
+    check_tcp,
+    check_rabbitmq,
+    check_event_repository_query,
+    check_environment_provider_configuration,
+    validate_dependencies,
+    OK,
+    FAILED,
+    SKIPPED,
+)
+
+logging.basicConfig(level=logging.DEBUG, stream=sys.stdout)
+
+
+class TestHealth:
+    """Test the health library."""
+
+    logger = logging.getLogger(__name__)
+    # Mark all test methods as asyncio methods to tell pytest to 'await' them.
+    pytestmark = pytest.mark.asyncio
+
+    @patch("etos_api.library.health.check_http")
+    async def test_validate_healthy_dependencies(self, check_http_mock):
+        """Test that no problems are reported when all dependencies are healthy.
+
+        Approval criteria:
+            - Validation shall not report problems for healthy dependencies.
+
+        Test steps::
+            1. Validate dependencies with healthy services.
+            2. Verify that no problems are reported.
+        """
+        etos_library = MagicMock()
+        etos_library.debug.disable_sending_events = True
+        check_http_mock.side_effect = lambda name, url: {
+            "name": name,
+            "status": OK,
+            "detail": None,
+            "duration": 0.0,
+        }
+        self.logger.info("STEP: Validate dependencies with healthy services.")
+        problems = await validate_dependencies(etos_library)
+        self.logger.info("STEP: Verify that no problems are reported.")
+        assert problems == []
+
+    async def test_validate_unconfigured_dependencies(self):
+        """Test that all dependency problems are reported at once.
+
+        Approval criteria:
+            - Validation shall report a problem for each unconfigured dependency.
+
+        Test steps::
+            1. Validate dependencies without any URLs configured.
+            2. Verify that a problem is reported for each dependency.
+        """
+        etos_library = MagicMock()
+        etos_library.debug.disable_sending_events = True
+        etos_library.debug.graphql_server = None
+        etos_library.debug.environment_provider = None
+        self.logger.info("STEP: Validate dependencies without any URLs configured.")
+        problems = await validate_dependencies(etos_library)
+        self.logger.info("STEP: Verify that a problem is reported for each dependency.")
+        assert problems == [
+            "event_repository: No URL configured",
+            "environment_provider: No URL configured",
+        ]
+
+    async def test_check_rabbitmq_configuration_failure(self):
+        """Test that a broken RabbitMQ configuration fails the RabbitMQ check.
+
+        Approval criteria:
+            - The RabbitMQ check shall fail if the configuration cannot be loaded.
+
+        Test steps::
+            1. Check RabbitMQ with a configuration that cannot be loaded.
+            2. Verify that the check failed with the error as detail.
+        """
+        etos_library = MagicMock()
+        etos_library.debug.disable_sending_events = False
+        config = etos_library.config
+        config.rabbitmq_publisher_from_environment.side_effect = ValueError("invalid")
+        self.logger.info(
+            "STEP: Check RabbitMQ with a configuration that cannot be loaded."
+        )
+        result = await check_rabbitmq(etos_library)
+        self.logger.info("STEP: Verify that the check failed with the error as detail.")
+        assert result["status"] == FAILED
+        assert result["detail"] == "invalid"
+
+    async def test_check_tcp(self):
+        """Test that the TCP check reports whether connections are accepted.
+
+        Approval criteria:
+            - The TCP check shall pass if the port accepts connections.
+            - The TCP check shall fail if the port is closed.
+
+        Test steps::
+            1. Check a port with a listening server.
+            2. Verify that the check passed.
+            3. Check the same port after the server has been closed.
+            4. Verify that the check failed.
+        """
+        server = await asyncio.start_server(
+            lambda _, writer: writer.close(), "127.0.0.1", 0
+        )
+        port = server.sockets[0].getsockname()[1]
+        self.logger.info("STEP: Check a port with a listening server.")
+        result = await check_tcp("tcp", "127.0.0.1", port)
+        self.logger.info("STEP: Verify that the check passed.")
+        assert result["status"] == OK
+
+        server.close()
+        await server.wait_closed()
+        self.logger.info("STEP: Check the same port after the server has been closed.")
+        result = await check_tcp("tcp", "127.0.0.1", port)
+        self.logger.info("STEP: Verify that the check failed.")
+        assert result["status"] == FAILED
+
+    @patch("etos_api.library.health.check_tcp")
+    async def test_check_rabbitmq(self, check_tcp_mock):
+        """Test that the RabbitMQ check connects to the configured server.
+
+        Approval criteria:
+            - The RabbitMQ check shall be skipped if sending events is disabled.
+            - The RabbitMQ check shall connect to the configured host and port.
+
+        Test steps::
+            1. Check RabbitMQ with sending events disabled.
+            2. Verify that the check was skipped.
+            3. Check RabbitMQ with a configured server.
+            4. Verify that the configured server was checked.
+        """
+        etos_library = MagicMock()
+        etos_library.debug.disable_sending_events = True
+        self.logger.info("STEP: Check RabbitMQ with sending events disabled.")
+        result = await check_rabbitmq(etos_library)
+        self.logger.info("STEP: Verify that the check was skipped.")
+        assert result["status"] == SKIPPED
+        check_tcp_mock.assert_not_called()
+
+        etos_library.debug.disable_sending_events = False
+        etos_library.config.get.return_value = {"host": "rabbitmq", "port": 5671}
+        check_tcp_mock.return_value = {"name": "rabbitmq", "status": OK}
+        self.logger.info("STEP: Check RabbitMQ with a configured server.")
+        result = await check_rabbitmq(etos_library)
+        self.logger.info("STEP: Verify that the configured server was checked.")
+        assert result["status"] == OK
+        check_tcp_mock.assert_called_once_with("rabbitmq", "rabbitmq", 5671)
+
+    @patch("etos_api.library.health.GraphqlQueryHandler")
+    async def test_check_event_repository_query(self, query_handler_mock):
+        """Test that the event repository query check reports query failures.
+
+        Approval criteria:
+            - The query check shall pass if the query returns a response.
+            - The query check shall fail if the query fails or times out.
+
+        Test steps::
+            1. Check the event repository with a working query.
+            2. Verify that the check passed.
+            3. Check the event repository with a failing query.
+            4. Verify that the check failed.
+            5. Check the event repository with a query that does not respond.
+            6. Verify that the check failed when the health check timed out.
+        """
+        execute = AsyncMock(return_value={"__typename": "Query"})
+        query_handler_mock.return_value.execute = execute
+        self.logger.info("STEP: Check the event repository with a working query.")
+        result = await check_event_repository_query(MagicMock())
+        self.logger.info("STEP: Verify that the check passed.")
+        assert result["status"] == OK
+
+        execute.side_effect = ConnectionError("Connection refused")
+        self.logger.info("STEP: Check the event repository with a failing query.")
+        result = await check_event_repository_query(MagicMock())
+        self.logger.info("STEP: Verify that the check failed.")
+        assert result["status"] == FAILED
+        assert result["detail"] == "Connection refused"
+
+        async def never_respond(*_, **__):
+            """Simulate a query that does not respond in time."""
+            await asyncio.sleep(10)
+
+        execute.side_effect = never_respond
+        self.logger.info(
+            "STEP: Check the event repository with a query that does not respond."
+        )
+        result = await check_event_repository_query(MagicMock(), timeout=0.01)
+        self.logger.info(
+            "STEP: Verify that the check failed when the health check timed out."
+        )
+        assert result["status"] == FAILED
+        assert result["detail"] == "Query timed out"
+
+    @patch("etos_api.library.health.aiohttp.ClientSession")
+    async def test_check_environment_provider_configuration(self, mock_client):
+        """Test that the environment provider configuration lookup is checked.
+
+        Approval criteria:
+            - The check shall pass if the environment provider responds with JSON.
+            - The check shall fail if the environment provider responds with an error.
+
+        Test steps::
+            1. Check the environment provider configuration lookup.
+            2. Verify that the check passed and a configuration was requested.
+            3. Check the configuration lookup with a failing environment provider.
+            4. Verify that the check failed.
+        """
+        etos_library = MagicMock()
+        etos_library.debug.environment_provider = "http://environment-provider"
+        mock_client().__aenter__.return_value = mock_client
+        mock_client.get().__aenter__.return_value = mock_client
+        mock_client.get.reset_mock()
+        mock_client.status = 200
+        mock_client.json = AsyncMock(return_value={"dataset": None})
+        self.logger.info("STEP: Check the environment provider configuration lookup.")
+        result = await check_environment_provider_configuration(etos_library)
+        self.logger.info(
+            "STEP: Verify that the check passed and a configuration was requested."
+        )
+        assert result["status"] == OK
+        mock_client.get.assert_called_once()
+        args, kwargs = mock_client.get.call_args
+        assert args == ("http://environment-provider/configure",)
+        assert "suite_id" in kwargs["params"]
+
+        mock_client.status = 500
+        mock_client.reason = "Internal Server Error"
+        self.logger.info(
+            "STEP: Check the configuration lookup with a failing environment provider."
+        )
+        result = await check_environment_provider_configuration(etos_library)
+        self.logger.info("STEP: Verify that the check failed.")
+        assert result["status"] == FAILED
+        assert result["detail"] == "HTTP 500 Internal Server Error"
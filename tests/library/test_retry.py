@@ -0,0 +1,129 @@
+# Copyright 2021 Axis Communications AB.
+#
+# For a full list of individual contributors, please see the commit history.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+"""Tests for the retry library."""
+import logging
+import sys
+from itertools import islice
+from unittest.mock import AsyncMock
+import pytest
+from etos_api.library.retry import Backoff, retry, poll
+
+logging.basicConfig(level=logging.DEBUG, stream=sys.stdout)
+
+
+class TestRetry:
+    """Test the retry library."""
+
+    logger = logging.getLogger(__name__)
+    # Mark all test methods as asyncio methods to tell pytest to 'await' them.
+    pytestmark = pytest.mark.asyncio
+
+    async def test_backoff_delays(self):
+        """Test that backoff delays grow exponentially up to the maximum.
+
+        Approval criteria:
+            - Delays shall be multiplied after each retry, within the jitter.
+            - Delays shall never exceed the maximum, plus jitter.
+
+        Test steps::
+            1. Generate delays from a backoff policy.
+            2. Verify that the delays grow up to the maximum.
+        """
+        self.logger.info("STEP: Generate delays from a backoff policy.")
+        delays = list(islice(Backoff(1, maximum=4, jitter=0.1).delays(), 5))
+        self.logger.info("STEP: Verify that the delays grow up to the maximum.")
+        for delay, expected in zip(delays, [1, 2, 4, 4, 4]):
+            assert expected * 0.9 <= delay <= expected * 1.1
+
+    async def test_retry(self):
+        """Test that a function is retried until it succeeds.
+
+        Approval criteria:
+            - Functions shall be retried on the given exceptions.
+
+        Test steps::
+            1. Retry a function that fails twice.
+            2. Verify that the result is returned after three attempts.
+        """
+        function = AsyncMock(side_effect=[ConnectionError(), ConnectionError(), "ok"])
+        self.logger.info("STEP: Retry a function that fails twice.")
+        result = await retry(function, Backoff(0), retry_on=(ConnectionError,))
+        self.logger.info(
+            "STEP: Verify that the result is returned after three attempts."
+        )
+        assert result == "ok"
+        assert function.await_count == 3
+
+    async def test_retry_attempts(self):
+        """Test that the last exception is raised when all attempts have failed.
+
+        Approval criteria:
+            - Functions shall not be called more than the maximum attempts.
+            - Exceptions that should not be retried shall be raised immediately.
+
+        Test steps::
+            1. Retry a function that always fails.
+            2. Verify that the exception is raised after all attempts.
+            3. Retry a function with an exception that should not be retried.
+            4. Verify that the exception is raised after one attempt.
+        """
+        function = AsyncMock(side_effect=ConnectionError())
+        self.logger.info("STEP: Retry a function that always fails.")
+        with pytest.raises(ConnectionError):
+            await retry(function, Backoff(0), attempts=3)
+        self.logger.info(
+            "STEP: Verify that the exception is raised after all attempts."
+        )
+        assert function.await_count == 3
+
+        function = AsyncMock(side_effect=ValueError())
+        self.logger.info(
+            "STEP: Retry a function with an exception that should not be retried."
+        )
+        with pytest.raises(ValueError):
+            await retry(function, Backoff(0), retry_on=(ConnectionError,))
+        with pytest.raises(ValueError):
+            await retry(function, Backoff(0), should_retry=lambda _: False)
+        self.logger.info("STEP: Verify that the exception is raised after one attempt.")
+        assert function.await_count == 2
+
+    async def test_poll(self):
+        """Test that polling returns the first result or None on timeout.
+
+        Approval criteria:
+            - Polling shall return the first result that is not None.
+            - Polling shall return None when the timeout is reached.
+
+        Test steps::
+            1. Poll a function that returns a result on the second call.
+            2. Verify that the result is returned.
+            3. Poll a function that never returns a result.
+            4. Verify that None is returned after the timeout.
+        """
+        function = AsyncMock(side_effect=[None, "ready"])
+        self.logger.info(
+            "STEP: Poll a function that returns a result on the second call."
+        )
+        result = await poll(function, Backoff(0), timeout=1)
+        self.logger.info("STEP: Verify that the result is returned.")
+        assert result == "ready"
+
+        function = AsyncMock(return_value=None)
+        self.logger.info("STEP: Poll a function that never returns a result.")
+        result = await poll(function, Backoff(0.01), timeout=0.05)
+        self.logger.info("STEP: Verify that None is returned after the timeout.")
+        assert result is None
+        assert function.await_count >= 1
@@ -0,0 +1,77 @@
+# Copyright 2021 Axis Communications AB.
+#
+# For a full list of individual contributors, please see the commit history.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+"""Tests for the timings library."""
+import asyncio
+import logging
+import sys
+import pytest
+from etos_api.library.timings import TIMINGS, start_timings, timed, format_timings
+
+logging.basicConfig(level=logging.DEBUG, stream=sys.stdout)
+
+
+class TestTimings:
+    """Test the timings library."""
+
+    logger = logging.getLogger(__name__)
+    # Mark all test methods as asyncio methods to tell pytest to 'await' them.
+    pytestmark = pytest.mark.asyncio
+
+    async def test_timed_sums_repeated_names(self):
+        """Test that blocks with the same name are summed up.
+
+        Approval criteria:
+            - Repeated timed blocks with the same name shall be summed.
+
+        Test steps::
+            1. Start timings and time two blocks with the same name.
+            2. Verify that there is one entry with the summed duration.
+        """
+
+        async def measure():
+            """Time two blocks with the same name in a separate context."""
+            timings = start_timings()
+            async with timed("upstream"):
+                await asyncio.sleep(0.01)
+            async with timed("upstream"):
+                await asyncio.sleep(0.01)
+            return timings
+
+        self.logger.info("STEP: Start timings and time two blocks with the same name.")
+        # Run in a task so that the timings context does not leak to other tests.
+        timings = await asyncio.ensure_future(measure())
+        self.logger.info(
+            "STEP: Verify that there is one entry with the summed duration."
+        )
+        assert list(timings.keys()) == ["upstream"]
+        assert timings["upstream"] >= 0.02
+        assert format_timings(timings).startswith("upstream;dur=")
+
+    async def test_timed_without_start(self):
+        """Test that timed does nothing unless timings have been started.
+
+        Approval criteria:
+            - Timed blocks shall not record anything without start_timings.
+
+        Test steps::
+            1. Time a block without starting timings.
+            2. Verify that no timings were recorded.
+        """
+        self.logger.info("STEP: Time a block without starting timings.")
+        async with timed("upstream"):
+            pass
+        self.logger.info("STEP: Verify that no timings were recorded.")
+        assert TIMINGS.get() is None
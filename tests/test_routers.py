@@ -19,6 +19,7 @@ import sys
 from unittest.mock import patch
 from fastapi.testclient import TestClient
 from etos_lib.lib.debug import Debug
+from etos_api.library.errors import EtosError
 from etos_api.main import APP
 
 logging.basicConfig(level=logging.DEBUG, stream=sys.stdout)
@@ -279,6 +280,330 @@ class TestRouters:
             headers={"Content-Type": "application/json", "Accept": "application/json"},
         )
 
+    @patch("etos_api.library.validator.SuiteValidator._download_suite")
+    def test_start_etos_invalid_suite(self, download_suite_mock):
+        """Test that an invalid test suite returns an error body.
+
+        Approval criteria:
+            - An invalid test suite shall return 400 with an error body.
+
+        Test steps::
+            1. Send a POST request to etos with an invalid test suite.
+            2. Verify that the status code is 400 and the error body is returned.
+        """
+        download_suite_mock.return_value = [{"name": "TestRouters"}]
+        self.logger.info(
+            "STEP: Send a POST request to etos with an invalid test suite."
+        )
+        response = self.client.post(
+            "/etos",
+            json={
+                "artifact_identity": "pkg:testing/etos",
+                "test_suite_url": "http://localhost/my_test.json",
+            },
+        )
+        self.logger.info(
+            "STEP: Verify that the status code is 400 and the error body is returned."
+        )
+        assert response.status_code == 400
+        body = response.json()
+        assert body["code"] == "invalid_test_suite"
+        assert body["retryable"] is False
+        assert body["identifier"] is not None
+        assert body["details"]
+
+    @patch("etos_api.library.validator.SuiteValidator._download_suite")
+    @patch("etos_api.library.graphql.GraphqlQueryHandler.execute")
+    def test_start_etos_event_repository_down(
+        self, graphql_execute_mock, download_suite_mock
+    ):
+        """Test that an unreachable event repository returns a retryable error.
+
+        Approval criteria:
+            - An unreachable event repository shall return 503 with Retry-After.
+
+        Test steps::
+            1. Send a POST request to etos with the event repository failing.
+            2. Verify that the status code is 503 and the error is retryable.
+        """
+        graphql_execute_mock.side_effect = Exception("Connection refused")
+        download_suite_mock.return_value = [
+            {
+                "name": "TestRouters",
+                "priority": 1,
+                "recipes": [
+                    {
+                        "constraints": [
+                            {"key": "ENVIRONMENT", "value": {}},
+                            {"key": "PARAMETERS", "value": {}},
+                            {"key": "COMMAND", "value": "exit 0"},
+                            {"key": "TEST_RUNNER", "value": "TestRunner"},
+                            {"key": "EXECUTE", "value": []},
+                            {"key": "CHECKOUT", "value": ["echo 'checkout'"]},
+                        ],
+                        "id": "132a7499-7ad4-4c4a-8a66-4e9ac95c7885",
+                        "testCase": {
+                            "id": "test_start_etos",
+                            "tracker": "Github",
+                            "url": "https://github.com/eiffel-community/etos-api",
+                        },
+                    }
+                ],
+            }
+        ]
+        self.logger.info(
+            "STEP: Send a POST request to etos with the event repository failing."
+        )
+        response = self.client.post(
+            "/etos",
+            json={
+                "artifact_identity": "pkg:testing/etos",
+                "test_suite_url": "http://localhost/my_test.json",
+            },
+        )
+        self.logger.info(
+            "STEP: Verify that the status code is 503 and the error is retryable."
+        )
+        assert response.status_code == 503
+        assert response.headers.get("Retry-After") is not None
+        body = response.json()
+        assert body["code"] == "event_repository_unavailable"
+        assert body["retryable"] is True
+
+    def test_not_found_error_body(self):
+        """Test that errors raised by the framework also return an error body.
+
+        Approval criteria:
+            - Requests to unknown endpoints shall return 404 with an error body.
+
+        Test steps::
+            1. Send a GET request to an unknown endpoint.
+            2. Verify that the status code is 404 and the error body is returned.
+        """
+        self.logger.info("STEP: Send a GET request to an unknown endpoint.")
+        response = self.client.get("/does/not/exist")
+        self.logger.info(
+            "STEP: Verify that the status code is 404 and the error body is returned."
+        )
+        assert response.status_code == 404
+        assert response.json()["code"] == "not_found"
+        assert response.json()["retryable"] is False
+
+    def test_validation_error_body(self):
+        """Test that request validation errors return an error body.
+
+        Approval criteria:
+            - Invalid requests shall return 422 with the validation errors.
+
+        Test steps::
+            1. Send a POST request to etos with both artifact ID and identity.
+            2. Verify that the status code is 422 and the errors are returned.
+        """
+        self.logger.info(
+            "STEP: Send a POST request to etos with both artifact ID and identity."
+        )
+        response = self.client.post(
+            "/etos",
+            json={
+                "artifact_identity": "pkg:testing/etos",
+                "artifact_id": "a7d9a5e7-3f5f-4b38-8c1f-3b1e6b9b5a3f",
+                "test_suite_url": "http://localhost/my_test.json",
+            },
+        )
+        self.logger.info(
+            "STEP: Verify that the status code is 422 and the errors are returned."
+        )
+        assert response.status_code == 422
+        body = response.json()
+        assert body["code"] == "validation_error"
+        assert body["details"]
+        assert body["detail"] == body["details"]
+
+    @patch("etos_api.library.validator.SuiteValidator.validate")
+    def test_unhandled_error_body(self, validate_mock):
+        """Test that unhandled exceptions return an error body.
+
+        Approval criteria:
+            - Unhandled exceptions shall return 500 with an error body.
+
+        Test steps::
+            1. Send a POST request to etos with suite validation crashing.
+            2. Verify that the status code is 500 and the error body is returned.
+        """
+        validate_mock.side_effect = RuntimeError("crash")
+        client = TestClient(APP, raise_server_exceptions=False)
+        self.logger.info(
+            "STEP: Send a POST request to etos with suite validation crashing."
+        )
+        response = client.post(
+            "/etos",
+            json={
+                "artifact_identity": "pkg:testing/etos",
+                "test_suite_url": "http://localhost/my_test.json",
+            },
+        )
+        self.logger.info(
+            "STEP: Verify that the status code is 500 and the error body is returned."
+        )
+        assert response.status_code == 500
+        assert response.json()["code"] == "internal_error"
+
+    @patch("etos_api.library.validator.SuiteValidator.validate")
+    @patch("etos_api.routers.etos.router.wait_for_artifact_created")
+    @patch("etos_api.routers.etos.router.configure_environment_provider")
+    def test_start_etos_environment_provider_error(
+        self, configure_mock, wait_for_artifact_mock, _
+    ):
+        """Test that environment provider errors reach the client unchanged.
+
+        Approval criteria:
+            - Errors from the environment provider shall keep their error code.
+
+        Test steps::
+            1. Send a POST request to etos with the configuration not applying.
+            2. Verify that the environment provider error body is returned.
+        """
+        wait_for_artifact_mock.return_value = [
+            {
+                "node": {
+                    "meta": {"id": "cda58701-5614-49bf-9101-1b71a6e0ef0c"},
+                    "data": {"identity": "pkg:testing/etos"},
+                }
+            }
+        ]
+        configure_mock.side_effect = EtosError(
+            status_code=503,
+            code="environment_provider_configuration_failed",
+            message="Environment provider configuration did not apply properly",
+            identifier="suite",
+            retryable=True,
+        )
+        self.logger.info(
+            "STEP: Send a POST request to etos with the configuration not applying."
+        )
+        response = self.client.post(
+            "/etos",
+            json={
+                "artifact_identity": "pkg:testing/etos",
+                "test_suite_url": "http://localhost/my_test.json",
+            },
+        )
+        self.logger.info(
+            "STEP: Verify that the environment provider error body is returned."
+        )
+        assert response.status_code == 503
+        assert response.json()["code"] == "environment_provider_configuration_failed"
+        assert response.json()["identifier"] == "suite"
+
+    @patch("etos_api.library.graphql.GraphqlQueryHandler.execute")
+    def test_wait_for_testrun(self, graphql_execute_mock):
+        """Test that waiting for a testrun returns its verdict when it has finished.
+
+        Approval criteria:
+            - The wait endpoint shall return the conclusion and the worst verdict.
+
+        Test steps::
+            1. Send a GET request to wait for a finished testrun.
+            2. Verify that the conclusion and the aggregated verdict are returned.
+        """
+        tercc = "2b9cb3e4-f88b-4cd0-a5bd-8d59fd5f7b6c"
+        events = {
+            "activityTriggered": [{"node": {"meta": {"id": "activity"}}}],
+            "activityCanceled": [],
+            "activityFinished": [
+                {
+                    "node": {
+                        "data": {
+                            "activityOutcome": {
+                                "conclusion": "SUCCESSFUL",
+                                "description": "Done",
+                            }
+                        }
+                    }
+                }
+            ],
+        }
+        verdicts = {"suite1": "PASSED", "suite2": "FAILED"}
+
+        def execute(query, **_):
+            """Return the events of a finished testrun for each query."""
+            if "testSuiteStarted" in query:
+                # One suite per page to verify that all pages are fetched.
+                suite = "suite2" if 'after: "cursor1"' in query else "suite1"
+                return {
+                    "testSuiteStarted": {
+                        "pageInfo": {
+                            "hasNextPage": suite == "suite1",
+                            "endCursor": "cursor1",
+                        },
+                        "edges": [{"node": {"meta": {"id": suite}}}],
+                    }
+                }
+            for event, edges in events.items():
+                if event in query:
+                    return {event: {"edges": edges}}
+            suite = "suite1" if "suite1" in query else "suite2"
+            outcome = {"testSuiteOutcome": {"verdict": verdicts[suite]}}
+            return {"testSuiteFinished": {"edges": [{"node": {"data": outcome}}]}}
+
+        graphql_execute_mock.side_effect = execute
+        self.logger.info("STEP: Send a GET request to wait for a finished testrun.")
+        response = self.client.get(f"/etos/v1/testrun/{tercc}/wait?timeout=10s")
+        self.logger.info(
+            "STEP: Verify that the conclusion and the aggregated verdict are returned."
+        )
+        assert response.status_code == 200
+        assert response.json() == {
+            "tercc": tercc,
+            "status": "FINISHED",
+            "conclusion": "SUCCESSFUL",
+            "verdict": "FAILED",
+            "description": "Done",
+        }
+
+    @patch("etos_api.library.graphql.GraphqlQueryHandler.execute")
+    def test_wait_for_testrun_timeout(self, graphql_execute_mock):
+        """Test that waiting for a testrun that does not finish times out.
+
+        Approval criteria:
+            - The wait endpoint shall return status 'TIMEOUT' when the timeout elapses.
+
+        Test steps::
+            1. Send a GET request to wait for a testrun that has not started.
+            2. Verify that the status is 'TIMEOUT'.
+        """
+        tercc = "2b9cb3e4-f88b-4cd0-a5bd-8d59fd5f7b6c"
+        graphql_execute_mock.return_value = {"activityTriggered": {"edges": []}}
+        self.logger.info(
+            "STEP: Send a GET request to wait for a testrun that has not started."
+        )
+        response = self.client.get(f"/etos/v1/testrun/{tercc}/wait?timeout=0")
+        self.logger.info("STEP: Verify that the status is 'TIMEOUT'.")
+        assert response.status_code == 200
+        assert response.json()["status"] == "TIMEOUT"
+        assert response.json()["verdict"] is None
+        graphql_execute_mock.assert_called_once()
+
+    def test_wait_for_testrun_invalid_timeout(self):
+        """Test that an invalid timeout is rejected.
+
+        Approval criteria:
+            - The wait endpoint shall return 400 for timeouts that cannot be parsed.
+
+        Test steps::
+            1. Send a GET request to wait with an invalid timeout.
+            2. Verify that the status code is 400 and the error code is returned.
+        """
+        tercc = "2b9cb3e4-f88b-4cd0-a5bd-8d59fd5f7b6c"
+        self.logger.info("STEP: Send a GET request to wait with an invalid timeout.")
+        response = self.client.get(f"/etos/v1/testrun/{tercc}/wait?timeout=soon")
+        self.logger.info(
+            "STEP: Verify that the status code is 400 and the error code is returned."
+        )
+        assert response.status_code == 400
+        assert response.json()["code"] == "invalid_timeout"
+        assert response.json()["identifier"] == tercc
+
     def test_selftest_get_ping(self):
         """Test that selftest ping with HTTP GET pings the system.
 
@@ -308,3 +633,186 @@ class TestRouters:
         response = self.client.head("/selftest/ping")
         self.logger.info("STEP: Verify that the status code is 204.")
         assert response.status_code == 204
+
+    def test_debug_timings(self):
+        """Test that a timing breakdown is returned when requested.
+
+        Approval criteria:
+            - Requests with 'X-Etos-Debug: timings' shall return 'Server-Timing'.
+            - Requests without the debug header shall not return 'Server-Timing'.
+
+        Test steps::
+            1. Send a GET request to selftest ping with the debug header.
+            2. Verify that the response has a 'Server-Timing' header with a total.
+            3. Send a GET request to selftest ping without the debug header.
+            4. Verify that the response has no 'Server-Timing' header.
+        """
+        self.logger.info(
+            "STEP: Send a GET request to selftest ping with the debug header."
+        )
+        response = self.client.get(
+            "/selftest/ping", headers={"X-Etos-Debug": "timings"}
+        )
+        self.logger.info(
+            "STEP: Verify that the response has a 'Server-Timing' header with a total."
+        )
+        assert response.status_code == 204
+        assert "total;dur=" in response.headers.get("Server-Timing", "")
+        self.logger.info(
+            "STEP: Send a GET request to selftest ping without the debug header."
+        )
+        response = self.client.get("/selftest/ping")
+        self.logger.info(
+            "STEP: Verify that the response has no 'Server-Timing' header."
+        )
+        assert "Server-Timing" not in response.headers
+
+    @patch("etos_api.routers.environment_provider.router.aiohttp.ClientSession")
+    def test_debug_timings_upstream(self, mock_client):
+        """Test that time spent in upstream services is part of the breakdown.
+
+        Approval criteria:
+            - Time spent in the environment provider shall be in 'Server-Timing'.
+
+        Test steps::
+            1. Send a POST request to configure with the debug header.
+            2. Verify that 'Server-Timing' has an 'environment-provider' entry.
+        """
+        mock_client().__aenter__.return_value = mock_client
+        mock_client.post().__aenter__.return_value = mock_client
+        mock_client.status = 200
+        mock_client.post.reset_mock()
+
+        self.logger.info(
+            "STEP: Send a POST request to configure with the debug header."
+        )
+        response = self.client.post(
+            "environment_provider/configure",
+            json={
+                "suite_id": "f5d5bc7b-c6b8-406f-a997-43c8217e32c1",
+                "dataset": {},
+                "iut_provider": "iut",
+                "execution_space_provider": "execution_space",
+                "log_area_provider": "log_area",
+            },
+            headers={"X-Etos-Debug": "timings"},
+        )
+        self.logger.info(
+            "STEP: Verify that 'Server-Timing' has an 'environment-provider' entry."
+        )
+        assert response.status_code == 204
+        server_timing = response.headers.get("Server-Timing", "")
+        assert "environment-provider;dur=" in server_timing
+        assert "total;dur=" in server_timing
+
+    @patch("etos_api.routers.selftest.router.deep_checks")
+    def test_selftest_deep(self, deep_checks_mock):
+        """Test that the deep selftest reports the result of each check.
+
+        Approval criteria:
+            - Deep selftest shall return status code 200 if all checks pass.
+            - Deep selftest shall return status code 503 if any check fails.
+
+        Test steps::
+            1. Send a GET request to deep selftest with passing checks.
+            2. Verify that the status code is 200 and all checks are reported.
+            3. Send a GET request to deep selftest with a failing check.
+            4. Verify that the status code is 503 and the status is failed.
+        """
+        checks = [
+            {"name": "event_repository", "status": "ok", "duration": 0.1},
+            {"name": "event_repository_query", "status": "ok", "duration": 0.1},
+            {
+                "name": "environment_provider_configuration",
+                "status": "ok",
+                "duration": 0.1,
+            },
+        ]
+        deep_checks_mock.return_value = checks
+        self.logger.info(
+            "STEP: Send a GET request to deep selftest with passing checks."
+        )
+        response = self.client.get("/selftest/deep")
+        self.logger.info(
+            "STEP: Verify that the status code is 200 and all checks are reported."
+        )
+        assert response.status_code == 200
+        assert response.json()["status"] == "ok"
+        assert [check["name"] for check in response.json()["checks"]] == [
+            "event_repository",
+            "event_repository_query",
+            "environment_provider_configuration",
+        ]
+
+        checks[1] = {
+            "name": "event_repository_query",
+            "status": "failed",
+            "detail": "Query timed out",
+            "duration": 5.0,
+        }
+        deep_checks_mock.return_value = checks
+        self.logger.info(
+            "STEP: Send a GET request to deep selftest with a failing check."
+        )
+        response = self.client.get("/selftest/deep")
+        self.logger.info(
+            "STEP: Verify that the status code is 503 and the status is failed."
+        )
+        assert response.status_code == 503
+        assert response.json()["status"] == "failed"
+
+    @patch("etos_api.routers.selftest.router.check_dependencies")
+    def test_statusz(self, check_dependencies_mock):
+        """Test that statusz aggregates the status of applications and dependencies.
+
+        Approval criteria:
+            - Statusz shall return 'ok' when all dependencies are healthy.
+            - Statusz shall return 'partial' when an application is down.
+
+        Test steps::
+            1. Send a GET request to statusz with all dependencies healthy.
+            2. Verify that the status is 'ok' for all applications.
+            3. Send a GET request to statusz with the environment provider failing.
+            4. Verify that the status is 'partial' and applications are affected.
+        """
+        dependencies = [
+            {"name": "event_repository", "status": "ok", "duration": 0.1},
+            {"name": "environment_provider", "status": "ok", "duration": 0.1},
+            {"name": "rabbitmq", "status": "skipped", "duration": 0.0},
+        ]
+        check_dependencies_mock.return_value = dependencies
+        self.logger.info(
+            "STEP: Send a GET request to statusz with all dependencies healthy."
+        )
+        response = self.client.get("/statusz")
+        self.logger.info("STEP: Verify that the status is 'ok' for all applications.")
+        assert response.status_code == 200
+        assert response.json()["status"] == "ok"
+        for application in response.json()["applications"]:
+            assert application["status"] == "ok"
+
+        dependencies[1] = {
+            "name": "environment_provider",
+            "status": "failed",
+            "detail": "Connection refused",
+            "duration": 0.1,
+        }
+        check_dependencies_mock.return_value = dependencies
+        self.logger.info(
+            "STEP: Send a GET request to statusz with the environment provider failing."
+        )
+        response = self.client.get("/statusz")
+        self.logger.info(
+            "STEP: Verify that the status is 'partial' and applications are affected."
+        )
+        assert response.status_code == 200
+        assert response.json()["status"] == "partial"
+        applications = {
+            application["name"]: application["status"]
+            for application in response.json()["applications"]
+        }
+        assert applications == {
+            "etos": "degraded",
+            "environment_provider": "down",
+            "selftest": "ok",
+        }
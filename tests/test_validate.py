@@ -0,0 +1,106 @@
+# Copyright 2021 Axis Communications AB.
+#
+# For a full list of individual contributors, please see the commit history.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+"""Tests for validation of ETOS API configuration and dependencies."""
+import logging
+import sys
+from unittest.mock import patch
+import pytest
+from etos_api.main import validate_on_startup
+from etos_api.validate import main
+
+logging.basicConfig(level=logging.DEBUG, stream=sys.stdout)
+
+
+class TestValidate:
+    """Test validation of configuration and dependencies."""
+
+    logger = logging.getLogger(__name__)
+
+    @patch("etos_api.validate.validate_dependencies")
+    @patch("etos_api.validate.ETOS")
+    def test_validate_command(self, _, validate_dependencies_mock):
+        """Test that the validate command exits normally without problems.
+
+        Approval criteria:
+            - The validate command shall not exit non-zero without problems.
+
+        Test steps::
+            1. Run the validate command with healthy dependencies.
+            2. Verify that the dependencies were validated.
+        """
+        validate_dependencies_mock.return_value = []
+        self.logger.info("STEP: Run the validate command with healthy dependencies.")
+        main()
+        self.logger.info("STEP: Verify that the dependencies were validated.")
+        validate_dependencies_mock.assert_called_once()
+
+    @patch("etos_api.validate.validate_dependencies")
+    @patch("etos_api.validate.ETOS")
+    def test_validate_command_problems(self, _, validate_dependencies_mock):
+        """Test that the validate command exits non-zero on problems.
+
+        Approval criteria:
+            - The validate command shall exit with status 1 if there are problems.
+
+        Test steps::
+            1. Run the validate command with a failing dependency.
+            2. Verify that the command exited with status 1.
+        """
+        validate_dependencies_mock.return_value = ["rabbitmq: Connection refused"]
+        self.logger.info("STEP: Run the validate command with a failing dependency.")
+        with pytest.raises(SystemExit) as exit_info:
+            main()
+        self.logger.info("STEP: Verify that the command exited with status 1.")
+        assert exit_info.value.code == 1
+
+    @pytest.mark.asyncio
+    @patch("etos_api.main.VALIDATE_ON_STARTUP", True)
+    @patch("etos_api.main.validate_dependencies")
+    @patch("etos_api.main.ETOS")
+    async def test_validate_on_startup(self, _, validate_dependencies_mock):
+        """Test that startup fails if validation on startup finds problems.
+
+        Approval criteria:
+            - The ETOS API shall not start if validation on startup fails.
+
+        Test steps::
+            1. Run the startup validation with a failing dependency.
+            2. Verify that startup failed.
+        """
+        validate_dependencies_mock.return_value = ["rabbitmq: Connection refused"]
+        self.logger.info("STEP: Run the startup validation with a failing dependency.")
+        with pytest.raises(RuntimeError):
+            await validate_on_startup()
+        self.logger.info("STEP: Verify that startup failed.")
+        validate_dependencies_mock.assert_called_once()
+
+    @pytest.mark.asyncio
+    @patch("etos_api.main.VALIDATE_ON_STARTUP", False)
+    @patch("etos_api.main.validate_dependencies")
+    async def test_validate_on_startup_disabled(self, validate_dependencies_mock):
+        """Test that no validation is done on startup unless enabled.
+
+        Approval criteria:
+            - Dependencies shall not be validated on startup unless enabled.
+
+        Test steps::
+            1. Run the startup validation while it is disabled.
+            2. Verify that no dependencies were validated.
+        """
+        self.logger.info("STEP: Run the startup validation while it is disabled.")
+        await validate_on_startup()
+        self.logger.info("STEP: Verify that no dependencies were validated.")
+        validate_dependencies_mock.assert_not_called()